@@ -18,6 +18,13 @@ func (p *RSSFeedPlugin) OnActivate() error {
 		return err
 	}
 
+	if err := p.ensureEncryptionKey(); err != nil {
+		p.API.LogError("Failed to generate the encryption key", "err", err.Error())
+	}
+	if err := p.migrateSecrets(""); err != nil {
+		p.API.LogError("Failed to encrypt the secrets of subscriptions", "err", err.Error())
+	}
+
 	p.API.RegisterCommand(getCommand())
 	p.processHeartBeatFlag = true
 	go p.setupHeartBeat()
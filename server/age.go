@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feedDateLayouts are the date formats found in the pubDate of RSS items, the
+// published and updated dates of Atom entries and the dates of scraped pages.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 06 15:04:05 -0700",
+	"Mon, 02 Jan 06 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// parseFeedDate parses a feed date, returning the zero time if it can not be
+// parsed.
+func parseFeedDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// getMaxItemAge returns the maximum age of items of the subscription, or zero
+// if there is no limit.
+func (p *RSSFeedPlugin) getMaxItemAge(subscription *Subscription) time.Duration {
+	days := subscription.MaxAge
+	if days == 0 {
+		days, _ = strconv.Atoi(p.getConfiguration().MaxItemAge)
+	}
+	if days <= 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// isTooOld reports whether an item was published longer ago than the maximum
+// age of the subscription. Items without a date are never too old.
+func (p *RSSFeedPlugin) isTooOld(subscription *Subscription, item *feedItem, now time.Time) bool {
+	maxAge := p.getMaxItemAge(subscription)
+	if maxAge == 0 || item.Published.IsZero() {
+		return false
+	}
+	return now.Sub(item.Published) > maxAge
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+// testAPI is an in memory implementation of the parts of the plugin API used
+// by the tests. Calling any other method panics.
+type testAPI struct {
+	plugin.API
+
+	kv    map[string][]byte
+	posts map[string]*model.Post
+	// created are the posts in the order they were created.
+	created []*model.Post
+	// failPosts makes CreatePost fail for posts it returns true for.
+	failPosts func(post *model.Post) bool
+	logs      []string
+	// pluginConfig are the stored settings of the plugin.
+	pluginConfig map[string]interface{}
+}
+
+func newTestPlugin() (*RSSFeedPlugin, *testAPI) {
+	api := &testAPI{
+		kv:    map[string][]byte{},
+		posts: map[string]*model.Post{},
+	}
+	p := &RSSFeedPlugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{})
+	return p, api
+}
+
+func (a *testAPI) KVGet(key string) ([]byte, *model.AppError) {
+	return a.kv[key], nil
+}
+
+func (a *testAPI) KVSet(key string, value []byte) *model.AppError {
+	a.kv[key] = value
+	return nil
+}
+
+func (a *testAPI) KVSetWithOptions(key string, value []byte, options model.PluginKVSetOptions) (bool, *model.AppError) {
+	a.kv[key] = value
+	return true, nil
+}
+
+func (a *testAPI) KVDelete(key string) *model.AppError {
+	delete(a.kv, key)
+	return nil
+}
+
+func (a *testAPI) CreatePost(post *model.Post) (*model.Post, *model.AppError) {
+	if a.failPosts != nil && a.failPosts(post) {
+		return nil, model.NewAppError("CreatePost", "test.create_post", nil, "", http.StatusBadRequest)
+	}
+
+	created := post.Clone()
+	created.Id = model.NewId()
+	created.CreateAt = model.GetMillis()
+	a.posts[created.Id] = created
+	a.created = append(a.created, created)
+	return created.Clone(), nil
+}
+
+func (a *testAPI) GetPost(postID string) (*model.Post, *model.AppError) {
+	post, ok := a.posts[postID]
+	if !ok {
+		return nil, model.NewAppError("GetPost", "test.get_post", nil, "", http.StatusNotFound)
+	}
+	return post.Clone(), nil
+}
+
+func (a *testAPI) UpdatePost(post *model.Post) (*model.Post, *model.AppError) {
+	if _, ok := a.posts[post.Id]; !ok {
+		return nil, model.NewAppError("UpdatePost", "test.update_post", nil, "", http.StatusNotFound)
+	}
+	a.posts[post.Id] = post.Clone()
+	return post.Clone(), nil
+}
+
+func (a *testAPI) LoadPluginConfiguration(dest interface{}) error {
+	data, err := json.Marshal(a.pluginConfig)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (a *testAPI) GetPluginConfig() map[string]interface{} {
+	if a.pluginConfig == nil {
+		return nil
+	}
+	config := map[string]interface{}{}
+	for name, value := range a.pluginConfig {
+		config[name] = value
+	}
+	return config
+}
+
+func (a *testAPI) SavePluginConfig(config map[string]interface{}) *model.AppError {
+	a.pluginConfig = config
+	return nil
+}
+
+func (a *testAPI) log(level string, msg string, keyValuePairs ...interface{}) {
+	a.logs = append(a.logs, strings.TrimSpace(fmt.Sprintln(append([]interface{}{level, msg}, keyValuePairs...)...)))
+}
+
+func (a *testAPI) LogDebug(msg string, keyValuePairs ...interface{}) {
+	a.log("debug", msg, keyValuePairs...)
+}
+
+func (a *testAPI) LogInfo(msg string, keyValuePairs ...interface{}) {
+	a.log("info", msg, keyValuePairs...)
+}
+
+func (a *testAPI) LogWarn(msg string, keyValuePairs ...interface{}) {
+	a.log("warn", msg, keyValuePairs...)
+}
+
+func (a *testAPI) LogError(msg string, keyValuePairs ...interface{}) {
+	a.log("error", msg, keyValuePairs...)
+}
+
+// channelPosts returns the created posts of a channel.
+func (a *testAPI) channelPosts(channelID string) []*model.Post {
+	posts := []*model.Post{}
+	for _, post := range a.created {
+		if post.ChannelId == channelID {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
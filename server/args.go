@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// commandUsage is the usage of each subcommand shown when its arguments are
+// invalid.
+var commandUsage = map[string]string{
+	"list":        "/feed list [~channel]",
+	"subscribe":   "/feed subscribe [~channel] <url> [--option value]...",
+	"unsubscribe": "/feed unsubscribe [~channel] <url>",
+	"set":         "/feed set [~channel] <url> <option> <value>",
+	"filter":      "/feed filter [~channel] <url> include|exclude <regex> | remove include|exclude <regex> | clear",
+	"auth":        "/feed auth [~channel] <url> basic <user> <password> | bearer <token> | header <name> <value> | query <name> <value> | clear",
+	"route":       "/feed route [~channel] <url> <category> ~channel|off",
+	"channel":     "/feed channel [~channel] <option> <value>",
+	"import":      "/feed import [post link]",
+	"export":      "/feed export [all]",
+	"help":        "/feed help",
+}
+
+// commandAliases maps the short forms of subcommands to their names.
+var commandAliases = map[string]string{
+	"sub":   "subscribe",
+	"unsub": "unsubscribe",
+}
+
+// commandFlags lists the subcommands that accept --option value flags.
+var commandFlags = map[string]bool{
+	"subscribe": true,
+}
+
+// commandTargets lists the subcommands that manage another channel when their
+// first argument is ~channel or ~team/channel.
+var commandTargets = map[string]bool{
+	"list":        true,
+	"subscribe":   true,
+	"unsubscribe": true,
+	"set":         true,
+	"filter":      true,
+	"auth":        true,
+	"route":       true,
+	"channel":     true,
+}
+
+// parsedCommand is a /feed command split into its subcommand, positional
+// arguments and flags.
+type parsedCommand struct {
+	Trigger    string
+	Action     string
+	Positional []string
+	Flags      map[string]string
+}
+
+// parseCommand parses a slash command. Arguments are separated by whitespace
+// unless quoted with single or double quotes; within double quotes, \" and \\
+// escape a quote and a backslash. Quotes only open at the beginning of an
+// argument or of a --flag= value, so apostrophes within words are kept.
+// Flags are given as --flag value or --flag=value, and a lone -- ends the
+// flags.
+func parseCommand(command string) (*parsedCommand, error) {
+	tokens, err := splitArguments(command)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &parsedCommand{Flags: map[string]string{}}
+	if len(tokens) > 0 {
+		parsed.Trigger = tokens[0].text
+	}
+	if len(tokens) < 2 {
+		return parsed, nil
+	}
+
+	parsed.Action = strings.ToLower(tokens[1].text)
+	if name, ok := commandAliases[parsed.Action]; ok {
+		parsed.Action = name
+	}
+
+	flagsEnded := false
+	for i := 2; i < len(tokens); i++ {
+		token := tokens[i]
+		if flagsEnded || !strings.HasPrefix(token.text, "--") || token.quoted {
+			parsed.Positional = append(parsed.Positional, token.text)
+			continue
+		}
+		if token.text == "--" {
+			flagsEnded = true
+			continue
+		}
+
+		name, value := strings.TrimPrefix(token.text, "--"), ""
+		if index := strings.Index(name, "="); index >= 0 {
+			name, value = name[:index], name[index+1:]
+		} else if i+1 < len(tokens) {
+			i++
+			value = tokens[i].text
+		} else {
+			return nil, fmt.Errorf("missing value for --%s", name)
+		}
+
+		name = strings.ToLower(name)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("invalid option %s", token.text)
+		}
+		if _, ok := parsed.Flags[name]; ok {
+			return nil, fmt.Errorf("option --%s is given more than once", name)
+		}
+		parsed.Flags[name] = value
+	}
+
+	if len(parsed.Flags) > 0 && !commandFlags[parsed.Action] {
+		for name := range parsed.Flags {
+			return nil, fmt.Errorf("unknown option --%s", name)
+		}
+	}
+
+	return parsed, nil
+}
+
+// commandToken is an argument of a command and whether it starts with a
+// quote.
+type commandToken struct {
+	text   string
+	quoted bool
+}
+
+func splitArguments(command string) ([]commandToken, error) {
+	tokens := []commandToken{}
+	var current strings.Builder
+	inToken, quoted := false, false
+	var quote rune
+	escaped := false
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			if r != '"' && r != '\\' {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case (r == '"' || r == '\'') && (!inToken || isFlagValueStart(current.String())):
+			quote = r
+			// only arguments starting with a quote are never flags, so that
+			// --flag="a b" still is one
+			quoted = quoted || !inToken
+			inToken = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inToken {
+				tokens = append(tokens, commandToken{text: current.String(), quoted: quoted})
+				current.Reset()
+				inToken, quoted = false, false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("missing closing quote")
+	}
+	if inToken {
+		tokens = append(tokens, commandToken{text: current.String(), quoted: quoted})
+	}
+
+	return tokens, nil
+}
+
+// isFlagValueStart reports whether an argument ends with the = of a
+// --flag=value, where a quoted value may start.
+func isFlagValueStart(argument string) bool {
+	return strings.HasPrefix(argument, "--") && strings.HasSuffix(argument, "=") && strings.Count(argument, "=") == 1
+}
+
+// usageError returns the message for invalid arguments of a subcommand.
+func usageError(action string, message string) string {
+	return fmt.Sprintf("%s\nUsage: `%s`", message, commandUsage[action])
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArguments(t *testing.T) {
+	for _, test := range []struct {
+		command  string
+		expected []commandToken
+	}{
+		{"", []commandToken{}},
+		{"  /feed \t list\n", []commandToken{{"/feed", false}, {"list", false}}},
+		{`/feed sub "a b" 'c d'`, []commandToken{{"/feed", false}, {"sub", false}, {"a b", true}, {"c d", true}}},
+		{`"" ''`, []commandToken{{"", true}, {"", true}}},
+		{`"a \"b\" \\ \n"`, []commandToken{{`a "b" \ \n`, true}}},
+		{`'a \'`, []commandToken{{`a \`, true}}},
+		{`--title="a b" --item='div.entry a'`, []commandToken{{"--title=a b", false}, {"--item=div.entry a", false}}},
+		{`"--title" x`, []commandToken{{"--title", true}, {"x", false}}},
+		{`--title=it's`, []commandToken{{"--title=it's", false}}},
+		{`don't "it's" rock'n'roll`, []commandToken{{"don't", false}, {"it's", true}, {"rock'n'roll", false}}},
+		{`a"b c"`, []commandToken{{`a"b`, false}, {`c"`, false}}},
+		{`--a=b="c d"`, []commandToken{{`--a=b="c`, false}, {`d"`, false}}},
+		{`"a b"c`, []commandToken{{"a bc", true}}},
+	} {
+		actual, err := splitArguments(test.command)
+		if err != nil {
+			t.Errorf("splitting %q: %v", test.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("splitting %q: got %+v, want %+v", test.command, actual, test.expected)
+		}
+	}
+
+	for _, command := range []string{`"a b`, `'a`, `--title="a`, `"a \"`} {
+		if tokens, err := splitArguments(command); err == nil {
+			t.Errorf("expected splitting %q to fail, got %+v", command, tokens)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	for _, test := range []struct {
+		command  string
+		expected *parsedCommand
+	}{{
+		command:  "/feed",
+		expected: &parsedCommand{Trigger: "/feed", Flags: map[string]string{}},
+	}, {
+		command:  "/feed LIST ~town-square",
+		expected: &parsedCommand{Trigger: "/feed", Action: "list", Positional: []string{"~town-square"}, Flags: map[string]string{}},
+	}, {
+		command: `/feed sub https://example.com/feed --Title "Release notes" --max-posts=3`,
+		expected: &parsedCommand{Trigger: "/feed", Action: "subscribe", Positional: []string{"https://example.com/feed"},
+			Flags: map[string]string{"title": "Release notes", "max-posts": "3"}},
+	}, {
+		command: `/feed subscribe https://example.com --type html --item="div.entry a" --title=it's`,
+		expected: &parsedCommand{Trigger: "/feed", Action: "subscribe", Positional: []string{"https://example.com"},
+			Flags: map[string]string{"type": "html", "item": "div.entry a", "title": "it's"}},
+	}, {
+		command: `/feed subscribe https://example.com "--title" -- --body x`,
+		expected: &parsedCommand{Trigger: "/feed", Action: "subscribe", Positional: []string{"https://example.com", "--title", "--body", "x"},
+			Flags: map[string]string{}},
+	}, {
+		command: `/feed set https://example.com title "it's a feed"`,
+		expected: &parsedCommand{Trigger: "/feed", Action: "set", Positional: []string{"https://example.com", "title", "it's a feed"},
+			Flags: map[string]string{}},
+	}} {
+		actual, err := parseCommand(test.command)
+		if err != nil {
+			t.Errorf("parsing %q: %v", test.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("parsing %q: got %+v, want %+v", test.command, actual, test.expected)
+		}
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	for command, expected := range map[string]string{
+		`/feed subscribe "https://example.com`:              "missing closing quote",
+		`/feed subscribe https://example.com --title`:       "missing value for --title",
+		`/feed subscribe https://example.com --=x`:          "invalid option --=x",
+		`/feed subscribe x --title a --TITLE b`:             "option --title is given more than once",
+		`/feed unsubscribe https://example.com --force=yes`: "unknown option --force",
+	} {
+		parsed, err := parseCommand(command)
+		if err == nil {
+			t.Errorf("expected parsing %q to fail, got %+v", command, parsed)
+			continue
+		}
+		if err.Error() != expected {
+			t.Errorf("parsing %q: got error %q, want %q", command, err.Error(), expected)
+		}
+	}
+}
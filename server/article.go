@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Limits of full article extraction.
+const (
+	articleFetchTimeout = 10 * time.Second
+	articleMaxBytes     = 2 * 1024 * 1024
+	articleCacheSeconds = 24 * 60 * 60
+)
+
+// articleBoilerplate elements never contain the main text of a page.
+var articleBoilerplate = map[atom.Atom]bool{
+	atom.Nav:    true,
+	atom.Header: true,
+	atom.Footer: true,
+	atom.Aside:  true,
+	atom.Form:   true,
+}
+
+var (
+	positiveArticleHints = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|story|text`)
+	negativeArticleHints = regexp.MustCompile(`(?i)ad-|ads|banner|combx|comment|community|disqus|footer|menu|meta|nav|popup|promo|related|share|sidebar|social|sponsor|widget`)
+)
+
+// getFullArticle returns the main text of the page an item links to if the
+// subscription has full article extraction enabled. Extracted articles are
+// cached in the KV store for a day.
+func (p *RSSFeedPlugin) getFullArticle(subscription *Subscription, link string) string {
+	if !subscription.FullArticle || len(link) == 0 {
+		return ""
+	}
+
+	key := fmt.Sprintf("article_%x", md5.Sum([]byte(link)))
+	if cached, appErr := p.API.KVGet(key); appErr == nil && cached != nil {
+		return string(cached)
+	}
+
+	page, err := p.fetch(link, subscription, articleFetchTimeout, articleMaxBytes)
+	if err != nil {
+		p.API.LogInfo("Unable to fetch full article",
+			"subscription_url", redactURL(subscription.URL),
+			"link", link,
+			"err", err.Error())
+		return ""
+	}
+
+	article := extractArticle(string(page), link)
+	if len(article) == 0 {
+		return ""
+	}
+
+	if _, appErr := p.API.KVSetWithOptions(key, []byte(article), model.PluginKVSetOptions{ExpireInSeconds: articleCacheSeconds}); appErr != nil {
+		p.API.LogError(appErr.Error())
+	}
+
+	return article
+}
+
+// extractArticle finds the element holding the main text of an HTML page,
+// preferring an article element and otherwise scoring elements by the amount
+// of paragraph text they contain, and renders it as markdown.
+func extractArticle(page string, base string) string {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return ""
+	}
+
+	removeBoilerplate(doc)
+
+	best := largestElement(doc, atom.Article)
+	if best == nil {
+		best = largestElement(doc, atom.Main)
+	}
+	if best == nil {
+		best = highestScoringElement(doc)
+	}
+	if best == nil {
+		return ""
+	}
+
+	return renderHTMLNode(best, base)
+}
+
+func removeBoilerplate(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && (articleBoilerplate[child.DataAtom] || droppedElements[child.DataAtom] || isBoilerplate(child)) {
+			n.RemoveChild(child)
+		} else {
+			removeBoilerplate(child)
+		}
+		child = next
+	}
+}
+
+// isBoilerplate reports whether the class or id of an element marks it as
+// something other than the article, such as comments or a sidebar.
+func isBoilerplate(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Html || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	hints := getAttribute(n, "class") + " " + getAttribute(n, "id")
+	return negativeArticleHints.MatchString(hints) && !positiveArticleHints.MatchString(hints)
+}
+
+// largestElement returns the element of the given type with the most text.
+func largestElement(doc *html.Node, a atom.Atom) *html.Node {
+	var best *html.Node
+	bestLength := 0
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == a {
+			if length := len(strings.TrimSpace(textContent(n))); length > bestLength {
+				best, bestLength = n, length
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return best
+}
+
+// highestScoringElement credits the text length of every paragraph to its
+// parent and half of it to its grandparent, and returns the element with the
+// highest score. Of elements with the same score, the first in the document
+// is returned.
+func highestScoringElement(doc *html.Node) *html.Node {
+	scores := map[*html.Node]float64{}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.P || n.DataAtom == atom.Pre) {
+			length := float64(len(strings.TrimSpace(textContent(n))))
+			if parent := n.Parent; parent != nil && length > 25 {
+				scores[parent] += length
+				if grandparent := parent.Parent; grandparent != nil {
+					scores[grandparent] += length / 2
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	bestScore := 0.0
+	var pick func(*html.Node)
+	pick = func(n *html.Node) {
+		if score, ok := scores[n]; ok {
+			if positiveArticleHints.MatchString(getAttribute(n, "class") + " " + getAttribute(n, "id")) {
+				score = score * 1.25
+			}
+			if score > bestScore {
+				best, bestScore = n, score
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			pick(child)
+		}
+	}
+	pick(doc)
+
+	return best
+}
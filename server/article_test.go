@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// TestExtractArticle extracts the article of every testdata/article/*.html
+// file, see testGoldenFiles.
+func TestExtractArticle(t *testing.T) {
+	testGoldenFiles(t, "article", func(input string) string {
+		return extractArticle(input, "https://example.com/blog/post.html")
+	})
+}
+
+func TestHighestScoringElement(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		page     string
+		expected string
+	}{
+		{
+			name:     "paragraph parent",
+			page:     `<div id="a"><p>` + strings.Repeat("a", 30) + `</p></div><div id="b"><p>` + strings.Repeat("b", 40) + `</p></div>`,
+			expected: "b",
+		},
+		{
+			name:     "grandparent collects several parents",
+			page:     `<div id="outer"><div id="a"><p>` + strings.Repeat("a", 40) + `</p></div><div id="b"><p>` + strings.Repeat("b", 40) + `</p></div><div id="c"><p>` + strings.Repeat("c", 40) + `</p></div></div>`,
+			expected: "outer",
+		},
+		{
+			name:     "positive hint",
+			page:     `<div id="a"><p>` + strings.Repeat("a", 44) + `</p></div><div id="b" class="entry"><p>` + strings.Repeat("b", 40) + `</p></div>`,
+			expected: "b",
+		},
+		{
+			name:     "first of equal scores",
+			page:     `<section><div id="a"><p>` + strings.Repeat("a", 40) + `</p></div></section><section><div id="b"><p>` + strings.Repeat("b", 40) + `</p></div></section>`,
+			expected: "a",
+		},
+		{
+			name:     "short paragraphs",
+			page:     `<div id="a"><p>Too short.</p></div>`,
+			expected: "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(test.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := ""
+			if best := highestScoringElement(doc); best != nil {
+				actual = getAttribute(best, "id")
+			}
+			if actual != test.expected {
+				t.Errorf("got element %q, want %q", actual, test.expected)
+			}
+		})
+	}
+}
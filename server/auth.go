@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// feedAuth are the credentials sent with the requests of a subscription.
+type feedAuth struct {
+	// Username and Password are sent with basic authentication.
+	Username string
+	Password string
+	// Token is sent as a bearer token.
+	Token string
+	// Headers are sent as they are, e.g. Private-Token for GitLab.
+	Headers map[string]string
+	// QueryName and QueryValue are added to the query of the URL.
+	QueryName  string
+	QueryValue string
+}
+
+// setOption changes the credentials according to /feed auth.
+func (a *feedAuth) setOption(method string, values []string) error {
+	switch method {
+	case "basic":
+		if len(values) != 2 {
+			return fmt.Errorf("please specify a username and a password")
+		}
+		a.Username, a.Password, a.Token = values[0], values[1], ""
+	case "bearer":
+		if len(values) != 1 {
+			return fmt.Errorf("please specify a token")
+		}
+		a.Token, a.Username, a.Password = values[0], "", ""
+	case "header":
+		if len(values) != 2 {
+			return fmt.Errorf("please specify a header name and a value")
+		}
+		name := http.CanonicalHeaderKey(values[0])
+		if name == "Host" || name == "User-Agent" {
+			return fmt.Errorf("the %s header can't be set", name)
+		}
+		if a.Headers == nil {
+			a.Headers = map[string]string{}
+		}
+		a.Headers[name] = values[1]
+	case "query":
+		if len(values) != 2 {
+			return fmt.Errorf("please specify a query parameter name and a value")
+		}
+		a.QueryName, a.QueryValue = values[0], values[1]
+	default:
+		return fmt.Errorf("invalid authentication method %s, expected basic, bearer, header, query or clear", method)
+	}
+	return nil
+}
+
+// describe names the kinds of credentials without revealing them.
+func (a *feedAuth) describe() string {
+	kinds := []string{}
+	if len(a.Username) > 0 {
+		kinds = append(kinds, "basic")
+	}
+	if len(a.Token) > 0 {
+		kinds = append(kinds, "bearer")
+	}
+	names := []string{}
+	for name := range a.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		kinds = append(kinds, "header "+name)
+	}
+	if len(a.QueryName) > 0 {
+		kinds = append(kinds, "query "+a.QueryName)
+	}
+	return strings.Join(kinds, ", ")
+}
+
+// apply adds the credentials to a request.
+func (a *feedAuth) apply(req *http.Request) {
+	if len(a.Username) > 0 {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	if len(a.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	for name, value := range a.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(a.QueryName) > 0 {
+		query := req.URL.Query()
+		query.Set(a.QueryName, a.QueryValue)
+		req.URL.RawQuery = query.Encode()
+	}
+}
+
+// redact replaces the secret values of the credentials in a message, such as
+// the query value that the HTTP client includes in the URLs of its errors.
+func (a *feedAuth) redact(message string) string {
+	secrets := []string{a.Password, a.Token, a.QueryValue, url.QueryEscape(a.QueryValue)}
+	for _, value := range a.Headers {
+		secrets = append(secrets, value)
+	}
+	for _, secret := range secrets {
+		if len(secret) > 0 {
+			message = strings.Replace(message, secret, redactedValue, -1)
+		}
+	}
+	return message
+}
+
+// remove takes the credentials off a request, e.g. when it is redirected to
+// another host.
+func (a *feedAuth) remove(req *http.Request) {
+	req.Header.Del("Authorization")
+	for name := range a.Headers {
+		req.Header.Del(name)
+	}
+}
+
+// getSubscriptionAuth decrypts the credentials of a subscription, or returns
+// nil if it has none.
+func (p *RSSFeedPlugin) getSubscriptionAuth(subscription *Subscription) (*feedAuth, error) {
+	if len(subscription.Auth) == 0 {
+		return nil, nil
+	}
+
+	data, err := p.decrypt(subscription.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &feedAuth{}
+	if err := json.Unmarshal(data, auth); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// setSubscriptionAuth encrypts the credentials of a subscription, removing
+// them if auth is nil.
+func (p *RSSFeedPlugin) setSubscriptionAuth(subscription *Subscription, auth *feedAuth) error {
+	if auth == nil {
+		subscription.Auth = ""
+		return nil
+	}
+
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := p.encrypt(data)
+	if err != nil {
+		return err
+	}
+	subscription.Auth = encrypted
+	return nil
+}
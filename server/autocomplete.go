@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// autocompleteSubscriptionsPath serves the subscribed URLs of a channel for
+// the dynamic autocomplete of the subcommands that take one.
+const autocompleteSubscriptionsPath = "/autocomplete/subscriptions"
+
+// autocompleteSubscriptionsURL is autocompleteSubscriptionsPath as requested by
+// the server, which only fetches dynamic lists from plugin URLs.
+var autocompleteSubscriptionsURL = "/plugins/" + manifest.ID + autocompleteSubscriptionsPath
+
+// subscriptionTypes are the values of the type option.
+var subscriptionTypes = []model.AutocompleteListItem{
+	{Item: "feed", HelpText: "RSS or Atom feed"},
+	{Item: "html", HelpText: "Web page without a feed, items derived from CSS selectors"},
+	{Item: "json", HelpText: "JSON API, items derived from JSONPath expressions"},
+	{Item: "ics", HelpText: "iCalendar feed"},
+}
+
+// subscriptionOptions are the options of subscriptions, which can be given
+// as flags of subscribe and changed with set.
+var subscriptionOptions = []model.AutocompleteListItem{
+	{Item: "thread", Hint: "off|daily|weekly", HelpText: "Posts the items as replies to a daily or weekly root post"},
+	{Item: "digest", Hint: "off|hourly|daily|weekly[@HH:MM]", HelpText: "Posts the items as a periodic digest"},
+	{Item: "window", Hint: "off|[days@]HH:MM-HH:MM", HelpText: "Only posts the items during the given times"},
+	{Item: "timezone", Hint: "[name]", HelpText: "Time zone of digests, threads and windows"},
+	{Item: "categories", Hint: "off|name,name", HelpText: "Only posts items in one of the categories"},
+	{Item: "maxage", Hint: "default|days", HelpText: "Skips items published more than the given number of days ago"},
+	{Item: "maxposts", Hint: "default|number", HelpText: "Limits the number of items posted at once"},
+	{Item: "fullarticle", Hint: "on|off", HelpText: "Posts the main text of the linked page"},
+	{Item: "insecure", Hint: "on|off", HelpText: "Skips the verification of the TLS certificate of the feed's host"},
+	{Item: "type", Hint: "feed|html|json|ics", HelpText: "Type of the subscription"},
+	{Item: "remind", Hint: "off|minutes", HelpText: "Posts a reminder before an event of an iCalendar feed starts"},
+	{Item: "item", Hint: "[selector or path]", HelpText: "CSS selector or JSONPath expression of the items"},
+	{Item: "id", Hint: "[selector or path]", HelpText: "CSS selector or JSONPath expression of the id of the items"},
+	{Item: "title", Hint: "[selector or path]", HelpText: "CSS selector or JSONPath expression of the title of the items"},
+	{Item: "link", Hint: "[selector or path]", HelpText: "CSS selector or JSONPath expression of the link of the items"},
+	{Item: "date", Hint: "[selector or path]", HelpText: "CSS selector or JSONPath expression of the date of the items"},
+	{Item: "body", Hint: "[selector or path]", HelpText: "CSS selector or JSONPath expression of the body of the items"},
+}
+
+// getAutocompleteData returns the autocomplete tree of the /feed command.
+func getAutocompleteData() *model.AutocompleteData {
+	feed := model.NewAutocompleteData("feed", "[command]", "Available commands: list, subscribe, sub, unsubscribe, unsub, set, filter, auth, route, channel, import, export, help")
+
+	list := model.NewAutocompleteData("list", "", "Lists the feeds this channel is subscribed to")
+	feed.AddCommand(list)
+
+	for _, trigger := range []string{"subscribe", "sub"} {
+		subscribe := model.NewAutocompleteData(trigger, "[~channel] [url]", "Subscribes this channel, or another channel, to a feed")
+		subscribe.AddTextArgument("URL of the feed", "[url]", "")
+		for _, option := range subscriptionOptions {
+			if option.Item == "type" {
+				subscribe.AddNamedStaticListArgument(option.Item, option.HelpText, false, subscriptionTypes)
+				continue
+			}
+			subscribe.AddNamedTextArgument(option.Item, option.HelpText, option.Hint, "", false)
+		}
+		feed.AddCommand(subscribe)
+	}
+
+	for _, trigger := range []string{"unsubscribe", "unsub"} {
+		unsubscribe := model.NewAutocompleteData(trigger, "[url]", "Unsubscribes this channel from a feed")
+		unsubscribe.AddDynamicListArgument("URL of the feed", autocompleteSubscriptionsURL, true)
+		feed.AddCommand(unsubscribe)
+	}
+
+	set := model.NewAutocompleteData("set", "[url] [option] [value]", "Changes an option of a subscription")
+	set.AddDynamicListArgument("URL of the feed", autocompleteSubscriptionsURL, true)
+	set.AddStaticListArgument("Option to change", true, subscriptionOptions)
+	set.AddTextArgument("New value of the option", "[value]", "")
+	feed.AddCommand(set)
+
+	filter := model.NewAutocompleteData("filter", "[url] include|exclude|remove|clear [regex]", "Only posts items matching, or not matching, regular expressions")
+	filter.AddDynamicListArgument("URL of the feed", autocompleteSubscriptionsURL, true)
+	filter.AddStaticListArgument("Action", true, []model.AutocompleteListItem{
+		{Item: "include", Hint: "[regex]", HelpText: "Only posts items matching the regular expression"},
+		{Item: "exclude", Hint: "[regex]", HelpText: "Skips items matching the regular expression"},
+		{Item: "remove", Hint: "include|exclude [regex]", HelpText: "Removes a filter"},
+		{Item: "clear", HelpText: "Removes all filters"},
+	})
+	filter.AddTextArgument("Regular expression", "[regex]", "")
+	feed.AddCommand(filter)
+
+	auth := model.NewAutocompleteData("auth", "[url] basic|bearer|header|query|clear [values]", "Sends credentials with the requests of a subscription")
+	auth.AddDynamicListArgument("URL of the feed", autocompleteSubscriptionsURL, true)
+	auth.AddStaticListArgument("Authentication method", true, []model.AutocompleteListItem{
+		{Item: "basic", Hint: "[user] [password]", HelpText: "Basic authentication"},
+		{Item: "bearer", Hint: "[token]", HelpText: "Bearer token in the Authorization header"},
+		{Item: "header", Hint: "[name] [value]", HelpText: "Custom header, e.g. Private-Token"},
+		{Item: "query", Hint: "[name] [value]", HelpText: "Query parameter added to the url"},
+		{Item: "clear", HelpText: "Removes all credentials"},
+	})
+	feed.AddCommand(auth)
+
+	route := model.NewAutocompleteData("route", "[url] [category] ~channel|off", "Posts the items of a category to another channel")
+	route.AddDynamicListArgument("URL of the feed", autocompleteSubscriptionsURL, true)
+	route.AddTextArgument("Category of the items", "[category]", "")
+	route.AddTextArgument("Channel to post the items to, or off", "~channel|off", "")
+	feed.AddCommand(route)
+
+	channel := model.NewAutocompleteData("channel", "[option] [value]", "Changes an option of all subscriptions in this channel")
+	channel.AddStaticListArgument("Option to change", true, []model.AutocompleteListItem{
+		{Item: "window", Hint: "off|[days@]HH:MM-HH:MM", HelpText: "Delivery window of subscriptions without their own window"},
+		{Item: "timezone", Hint: "[name]", HelpText: "Time zone of the channel's delivery window"},
+		{Item: "dedupe", Hint: "off|duration", HelpText: "Suppresses items already posted to this channel within the given time"},
+	})
+	channel.AddTextArgument("New value of the option", "[value]", "")
+	feed.AddCommand(channel)
+
+	importOPML := model.NewAutocompleteData("import", "[post link]", "Subscribes this channel to the feeds of an OPML file")
+	importOPML.AddTextArgument("Link of the post the file is attached to, defaults to your last post with a file", "[post link]", "")
+	feed.AddCommand(importOPML)
+
+	export := model.NewAutocompleteData("export", "[all]", "Sends you an OPML file of the feeds of this channel")
+	export.AddStaticListArgument("", false, []model.AutocompleteListItem{
+		{Item: "all", HelpText: "Exports the feeds of all channels, system admins only"},
+	})
+	feed.AddCommand(export)
+
+	help := model.NewAutocompleteData("help", "", "Shows the help of the /feed command")
+	feed.AddCommand(help)
+
+	return feed
+}
+
+// handleAutocompleteSubscriptions lists the URLs the channel of an
+// autocomplete request is subscribed to.
+func (p *RSSFeedPlugin) handleAutocompleteSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	channelID := r.URL.Query().Get("channel_id")
+	if len(userID) == 0 || !p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_READ_CHANNEL) {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	subscriptions, err := p.getSubscriptions()
+	if err != nil {
+		p.API.LogError(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := []model.AutocompleteListItem{}
+	for _, subscription := range subscriptions.Subscriptions {
+		if subscription.ChannelID == channelID {
+			items = append(items, model.AutocompleteListItem{Item: redactURL(subscription.URL), HelpText: subscriptionTitle(subscription)})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Item < items[j].Item })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
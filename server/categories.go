@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// rssCategories picks the categories of every item from an RSS feed, since
+// rssv2parser only keeps a single category per item.
+type rssCategories struct {
+	Items []struct {
+		Title      string   `xml:"title"`
+		PubDate    string   `xml:"pubDate"`
+		GUID       string   `xml:"guid"`
+		Categories []string `xml:"category"`
+	} `xml:"channel>item"`
+}
+
+// atomCategories picks the categories of every entry from an Atom feed, which
+// are not part of atom.Entry.
+type atomCategories struct {
+	Entries []struct {
+		ID         string `xml:"id"`
+		Categories []struct {
+			Term  string `xml:"term,attr"`
+			Label string `xml:"label,attr"`
+		} `xml:"category"`
+	} `xml:"entry"`
+}
+
+func decodeFeedXML(feedXML string, v interface{}) error {
+	decoder := xml.NewDecoder(strings.NewReader(feedXML))
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder.Decode(v)
+}
+
+// parseRSSCategories maps the key of every item of an RSS feed to its categories.
+func parseRSSCategories(feedXML string) map[string][]string {
+	categories := map[string][]string{}
+
+	feed := rssCategories{}
+	if err := decodeFeedXML(feedXML, &feed); err != nil {
+		return categories
+	}
+
+	for _, item := range feed.Items {
+		key := item.PubDate + "|" + item.Title
+		if len(item.GUID) > 0 {
+			key = item.GUID
+		}
+		for _, category := range item.Categories {
+			if category = strings.TrimSpace(category); len(category) > 0 {
+				categories[key] = append(categories[key], category)
+			}
+		}
+	}
+
+	return categories
+}
+
+// parseAtomCategories maps the ID of every entry of an Atom feed to its categories.
+func parseAtomCategories(feedXML string) map[string][]string {
+	categories := map[string][]string{}
+
+	feed := atomCategories{}
+	if err := decodeFeedXML(feedXML, &feed); err != nil {
+		return categories
+	}
+
+	for _, entry := range feed.Entries {
+		for _, category := range entry.Categories {
+			if term := strings.TrimSpace(category.Term); len(term) > 0 {
+				categories[entry.ID] = append(categories[entry.ID], term)
+			} else if label := strings.TrimSpace(category.Label); len(label) > 0 {
+				categories[entry.ID] = append(categories[entry.ID], label)
+			}
+		}
+	}
+
+	return categories
+}
+
+// hasCategory reports whether an item is in one of the given categories,
+// ignoring case.
+func hasCategory(item *feedItem, categories []string) bool {
+	for _, itemCategory := range item.Categories {
+		for _, category := range categories {
+			if strings.EqualFold(itemCategory, category) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesCategories reports whether an item is in one of the categories the
+// subscription is restricted to, if any.
+func (s *Subscription) matchesCategories(item *feedItem) bool {
+	return len(s.Categories) == 0 || hasCategory(item, s.Categories)
+}
+
+// routeChannelIDs returns the channels routed to the categories of an item,
+// or none if the item is not in a routed category.
+func (s *Subscription) routeChannelIDs(item *feedItem) []string {
+	channelIDs := []string{}
+	for category, channelID := range s.Routes {
+		if hasCategory(item, []string{category}) && !containsString(channelIDs, channelID) {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	sort.Strings(channelIDs)
+	return channelIDs
+}
+
+// routedTo returns the subscription as it delivers items to a channel, which
+// is a copy posting to the channel of a route, with its own delivery window,
+// queues and thread, or the subscription itself for the subscribed channel.
+// The copy shares the posts of items with the subscription, so that they can
+// be edited when an item changes.
+func (s *Subscription) routedTo(channelID string) *Subscription {
+	if channelID == s.ChannelID {
+		return s
+	}
+
+	if s.PostIDs == nil {
+		s.PostIDs = map[string]string{}
+	}
+
+	routed := *s
+	routed.ChannelID = channelID
+	routed.RootPostID, routed.RootPostCreated = "", 0
+	if thread, ok := s.RouteThreads[channelID]; ok {
+		routed.RootPostID, routed.RootPostCreated = thread.RootPostID, thread.RootPostCreated
+	}
+	return &routed
+}
+
+// updateRoute keeps the thread of a copy returned by routedTo.
+func (s *Subscription) updateRoute(routed *Subscription) {
+	if routed == s || len(routed.RootPostID) == 0 {
+		return
+	}
+
+	if s.RouteThreads == nil {
+		s.RouteThreads = map[string]*RouteThread{}
+	}
+	s.RouteThreads[routed.ChannelID] = &RouteThread{RootPostID: routed.RootPostID, RootPostCreated: routed.RootPostCreated}
+}
+
+// deliveryTargets returns the subscription and its copies for the channels of
+// its routes.
+func (s *Subscription) deliveryTargets() []*Subscription {
+	channelIDs := []string{}
+	for _, channelID := range s.Routes {
+		if channelID != s.ChannelID && !containsString(channelIDs, channelID) {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	sort.Strings(channelIDs)
+
+	targets := []*Subscription{s}
+	for _, channelID := range channelIDs {
+		targets = append(targets, s.routedTo(channelID))
+	}
+	return targets
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
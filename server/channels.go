@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChannelSettings holds the options that apply to all subscriptions of a
+// channel, set with /feed channel.
+type ChannelSettings struct {
+	Window   string
+	Timezone string
+	// Dedupe is either empty or the duration, e.g. 24h, during which items
+	// with the same link or title as an earlier item are not posted again.
+	Dedupe string
+}
+
+func getChannelSettingsKey(channelID string) string {
+	return fmt.Sprintf("channel_%s", channelID)
+}
+
+func (p *RSSFeedPlugin) getChannelSettings(channelID string) (*ChannelSettings, error) {
+	settings := &ChannelSettings{}
+
+	value, err := p.API.KVGet(getChannelSettingsKey(channelID))
+	if err != nil {
+		return nil, err
+	}
+
+	if value != nil {
+		json.NewDecoder(bytes.NewReader(value)).Decode(settings)
+	}
+
+	return settings, nil
+}
+
+func (p *RSSFeedPlugin) storeChannelSettings(channelID string, settings *ChannelSettings) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	if err := p.API.KVSet(getChannelSettingsKey(channelID), b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// setOption changes one of the options set with /feed channel.
+func (s *ChannelSettings) setOption(name string, value string) error {
+	switch name {
+	case "window":
+		if value == "off" {
+			s.Window = ""
+			break
+		}
+		if _, err := parseDeliveryWindow(value); err != nil {
+			return err
+		}
+		s.Window = value
+	case "timezone":
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("invalid time zone %s", value)
+		}
+		s.Timezone = value
+	case "dedupe":
+		if value == "off" {
+			s.Dedupe = ""
+			break
+		}
+		if _, err := parseDuration(value); err != nil {
+			return err
+		}
+		s.Dedupe = value
+	default:
+		return fmt.Errorf("unknown channel option %s", name)
+	}
+
+	return nil
+}
+
+// describeOptions lists the options that differ from the defaults for /feed list.
+func (s *ChannelSettings) describeOptions() string {
+	options := []string{}
+	if len(s.Window) > 0 {
+		options = append(options, "window: "+s.Window)
+	}
+	if len(s.Timezone) > 0 {
+		options = append(options, "timezone: "+s.Timezone)
+	}
+	if len(s.Dedupe) > 0 {
+		options = append(options, "dedupe: "+s.Dedupe)
+	}
+
+	if len(options) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(options, ", ") + ")"
+}
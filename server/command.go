@@ -7,12 +7,36 @@ import (
 	"github.com/mattermost/mattermost-server/v5/plugin"
 	"github.com/mattermost/mattermost-server/v5/shared/mlog"
 	"strings"
+	"time"
 )
 
 // COMMAND_HELP is the text you see when you type /feed help
 const COMMAND_HELP = `* |/feed subscribe url| or |/feed sub url| - Connect your Mattermost channel to an RSS feed 
+* |/feed subscribe url --digest hourly/daily/weekly@HH:MM| - Connect your Mattermost channel to an RSS feed and post its items as a periodic digest
+* |/feed subscribe url --type html --item selector [--id/title/link/date/body selector]| - Connect your Mattermost channel to a web page without a feed, deriving the items from CSS selectors
+* |/feed subscribe url --type json [--item path] [--id/title/link/date/body path]| - Connect your Mattermost channel to a JSON API, deriving the items from JSONPath expressions
+* |/feed subscribe url --type ics [--remind minutes]| - Connect your Mattermost channel to an iCalendar feed, optionally reminding of events the given number of minutes before they start
 * |/feed list| - Lists the RSS feeds you have subscribed to
-* |/feed unsubscribe url| or |/feed unsub url| - Unsubscribes the Mattermost channel from the RSS feed`
+* |/feed unsubscribe url| or |/feed unsub url| - Unsubscribes the Mattermost channel from the RSS feed
+* |/feed set url thread off/daily/weekly| - Posts the items of the RSS feed as replies to a daily or weekly root post
+* |/feed set url digest off/hourly/daily/weekly@HH:MM| - Posts the items of the RSS feed as a periodic digest
+* |/feed set url window mon-fri@08:00-18:00| - Only posts the items of the RSS feed during the given times and queues them otherwise
+* |/feed set url timezone name| - Sets the time zone used for digests, threads and windows, e.g. Europe/Berlin
+* |/feed filter url include/exclude regex| - Only posts items of the RSS feed whose title, content, categories or author match, or don't match, the regular expression
+* |/feed filter url remove include/exclude regex| or |/feed filter url clear| - Removes one or all filters of the RSS feed
+* |/feed set url categories name,name| - Only posts items of the RSS feed in one of the categories
+* |/feed set url maxage days/default| - Skips items of the RSS feed published more than the given number of days ago
+* |/feed set url maxposts number/default| - Limits the number of items of the RSS feed posted at once and lists the rest in a single post
+* |/feed set url fullarticle on/off| - Posts the main text of the page each item of the RSS feed links to instead of its description
+* |/feed set url insecure on/off| - Skips the verification of the TLS certificate of the RSS feed's host, e.g. for internal services with self-signed certificates
+* |/feed auth url basic user password|, |/feed auth url bearer token|, |/feed auth url header name value| or |/feed auth url query name value| - Sends credentials with the requests of the RSS feed, use |/feed auth url clear| to remove them
+* |/feed route url category ~channel| - Posts items of the RSS feed in the category to another channel instead, use |off| to remove the route
+* |/feed channel window mon-fri@08:00-18:00| - Sets the delivery window of all RSS feeds in this channel
+* |/feed channel timezone name| - Sets the time zone of the channel's delivery window
+* |/feed channel dedupe 24h| - Suppresses items with the same link or title as an item posted to this channel within the given time, use |off| to disable
+* |/feed import [post link]| - Subscribes this channel to the feeds of an OPML file, attached to the given post or to your last post in this channel
+* |/feed subscribe ~channel url|, |/feed list ~team/channel|, ... - Manages the subscriptions of another channel you can post in, the same works for unsubscribe, set, filter, route and channel
+* |/feed export [all]| - Sends you an OPML file of the feeds this channel, or as a system admin every channel, is subscribed to`
 
 func getCommand() *model.Command {
 	return &model.Command{
@@ -20,15 +44,16 @@ func getCommand() *model.Command {
 		DisplayName:      "RSSFeed",
 		Description:      "Allows user to subscribe to an RSS feed.",
 		AutoComplete:     true,
-		AutoCompleteDesc: "Available commands: list, subscribe, sub, unsubscribe, unsub, help",
+		AutoCompleteDesc: "Available commands: list, subscribe, sub, unsubscribe, unsub, set, filter, auth, route, channel, import, export, help",
 		AutoCompleteHint: "[command]",
+		AutocompleteData: getAutocompleteData(),
 	}
 }
 
 func getCommandResponse(responseType, text string) *model.CommandResponse {
 	return &model.CommandResponse{
 		ResponseType: responseType,
-		Text:         text,
+		Text:         redactURLs(text),
 		Username:     botDisplayName,
 		IconURL:      RSSFEED_ICON_URL,
 		Type:         model.POST_DEFAULT,
@@ -38,65 +63,311 @@ func getCommandResponse(responseType, text string) *model.CommandResponse {
 // ExecuteCommand will execute commands ...
 func (p *RSSFeedPlugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 
-	split := strings.Fields(args.Command)
-	command := split[0]
-	parameters := []string{}
-	action := ""
-	if len(split) > 1 {
-		action = split[1]
-	}
-	if len(split) > 2 {
-		parameters = split[2:]
+	parsed, err := parseCommand(args.Command)
+	if err != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Invalid command: %s.", err.Error())), nil
 	}
 
-	if command != "/feed" {
+	if parsed.Trigger != "/feed" {
 		return &model.CommandResponse{}, nil
 	}
+	action, parameters := parsed.Action, parsed.Positional
+
+	// a leading ~channel manages the subscriptions of another channel
+	channelID, channelName, where := args.ChannelId, "this channel", ""
+	if commandTargets[action] && len(parameters) > 0 && strings.HasPrefix(parameters[0], "~") {
+		channel, err := p.getChannelForUser(args.UserId, args.TeamId, parameters[0])
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+		channelID, channelName, where = channel.Id, parameters[0], " in "+parameters[0]
+		parameters = parameters[1:]
+	}
+
+	if commandManages[action] {
+		if err := p.canManageSubscriptions(args.UserId, channelID); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+	}
 
 	switch action {
 	case "list":
-		txt := "### Subscriptions in this channel\n"
+		if len(parameters) > 0 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "This command takes no arguments.")), nil
+		}
+
 		subscriptions, err := p.getSubscriptions()
 		if err != nil {
 			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
 		}
 
+		settings, err := p.getChannelSettings(channelID)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		txt := fmt.Sprintf("### Subscriptions in %s%s\n", channelName, settings.describeOptions())
+
 		for _, value := range subscriptions.Subscriptions {
-			if value.ChannelID == args.ChannelId {
-				txt += fmt.Sprintf("* `%s`\n", value.URL)
+			if value.ChannelID == channelID {
+				txt += fmt.Sprintf("* `%s`%s\n", value.URL, value.describeOptions())
+				txt += value.describeFilters()
+				txt += p.describeRoutes(value)
 			}
 		}
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, txt), nil
-	case "subscribe", "sub":
-
-		if len(parameters) == 0 {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Please specify a url."), nil
-		} else if len(parameters) > 1 {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Please specify a valid url."), nil
+	case "subscribe":
+		if len(parameters) != 1 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify a url.")), nil
 		}
 
 		url := parameters[0]
+		options := parsed.Flags
 
-		if err := p.subscribe(context.Background(), args.ChannelId, url); err != nil {
+		if _, ok := options["digest"]; ok {
+			if _, ok := options["timezone"]; !ok {
+				options["timezone"] = p.getUserTimezone(args.UserId)
+			}
+		}
+
+		if err := p.subscribe(context.Background(), channelID, url, options); err != nil {
 			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
 		}
 
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Successfully subscribed to %s.", url)), nil
-	case "unsubscribe", "unsub":
-		if len(parameters) == 0 {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Please specify a url."), nil
-		} else if len(parameters) > 1 {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Please specify a valid url."), nil
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Successfully subscribed to %s%s.", url, where)), nil
+	case "unsubscribe":
+		if len(parameters) != 1 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify a url.")), nil
 		}
 
 		url := parameters[0]
 
-		if err := p.unsubscribe(args.ChannelId, url); err != nil {
+		if err := p.unsubscribe(channelID, url); err == errAmbiguousURL {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		} else if err != nil {
 			mlog.Error(err.Error())
 			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to unsubscribe. Please try again."), nil
 		}
 
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Succesfully unsubscribed from %s.", url)), nil
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Succesfully unsubscribed from %s%s.", url, where)), nil
+	case "set":
+		if len(parameters) != 3 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify a url, an option and a value.")), nil
+		}
+
+		url, option, value := parameters[0], parameters[1], parameters[2]
+
+		subscription, err := p.getSubscription(channelID, url)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		previousDigest := subscription.Digest
+		if err := subscription.setOption(option, value); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		if err := subscription.validate(); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		if (option == "digest" || option == "window") && len(subscription.Timezone) == 0 {
+			subscription.Timezone = p.getUserTimezone(args.UserId)
+		}
+
+		// post what has been queued so far when the digest is turned off
+		if previousDigest != digestOff && subscription.Digest == digestOff {
+			for _, target := range subscription.deliveryTargets() {
+				if err := p.flushDigest(target, ""); err != nil {
+					p.API.LogError(err.Error())
+				}
+				subscription.updateRoute(target)
+			}
+		}
+
+		if err := p.updateSubscription(subscription); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to update the subscription. Please try again."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Successfully set %s to %s for %s%s.", option, value, url, where)), nil
+	case "filter":
+		if len(parameters) < 2 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify a url, include or exclude and a regular expression.")), nil
+		}
+
+		url, action := parameters[0], parameters[1]
+
+		subscription, err := p.getSubscription(channelID, url)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		txt := ""
+		switch action {
+		case "clear":
+			if len(parameters) > 2 {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError("filter", "Clearing the filters takes no regular expression.")), nil
+			}
+			subscription.Filters = nil
+			txt = fmt.Sprintf("Successfully removed all filters from %s.", url)
+		case "remove":
+			if len(parameters) < 4 {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError("filter", "Please specify include or exclude and the regular expression to remove.")), nil
+			}
+			pattern := strings.Join(parameters[3:], " ")
+			if !subscription.removeFilter(parameters[2], pattern) {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("There is no %s filter `%s` for %s.", parameters[2], pattern, url)), nil
+			}
+			txt = fmt.Sprintf("Successfully removed %s filter `%s` from %s.", parameters[2], pattern, url)
+		default:
+			if len(parameters) < 3 {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError("filter", "Please specify a regular expression.")), nil
+			}
+			filter, err := newFilter(action, strings.Join(parameters[2:], " "))
+			if err != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+			}
+			subscription.addFilter(filter)
+			txt = fmt.Sprintf("Successfully added %s filter `%s` to %s.", filter.Type, filter.Pattern, url)
+		}
+
+		if err := p.updateSubscription(subscription); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to update the subscription. Please try again."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, txt), nil
+	case "auth":
+		if len(parameters) < 2 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify a url and an authentication method.")), nil
+		}
+
+		url, method := parameters[0], parameters[1]
+
+		subscription, err := p.getSubscription(channelID, url)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		txt := fmt.Sprintf("Successfully removed the credentials of %s%s.", url, where)
+		if method == "clear" {
+			if len(parameters) > 2 {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Clearing the credentials takes no values.")), nil
+			}
+			if err := p.setSubscriptionAuth(subscription, nil); err != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+			}
+		} else {
+			auth, err := p.getSubscriptionAuth(subscription)
+			if err != nil || auth == nil {
+				// credentials that can't be decrypted anymore are replaced
+				auth = &feedAuth{}
+			}
+			if err := auth.setOption(method, parameters[2:]); err != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, err.Error()+".")), nil
+			}
+			if err := p.setSubscriptionAuth(subscription, auth); err != nil {
+				p.API.LogError(err.Error())
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to store the credentials. Please try again."), nil
+			}
+			txt = fmt.Sprintf("Successfully set the credentials of %s%s, now using %s.", url, where, auth.describe())
+		}
+
+		if err := p.updateSubscription(subscription); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to update the subscription. Please try again."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, txt), nil
+	case "route":
+		if len(parameters) != 3 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify a url, a category and a channel.")), nil
+		}
+
+		url, category, target := parameters[0], parameters[1], parameters[2]
+
+		subscription, err := p.getSubscription(channelID, url)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		txt := fmt.Sprintf("Successfully removed the route of category %s from %s.", category, url)
+		if target == "off" {
+			subscription.setRoute(category, "")
+		} else {
+			channel, err := p.getChannelForUser(args.UserId, args.TeamId, target)
+			if err != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+			}
+			// routed items are posted to the target, so it must be managed like the subscribed channel
+			if err := p.canManageSubscriptions(args.UserId, channel.Id); err != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Unable to route to ~%s: %s.", channel.Name, err.Error())), nil
+			}
+			subscription.setRoute(category, channel.Id)
+			txt = fmt.Sprintf("Successfully routed category %s of %s to ~%s.", category, url, channel.Name)
+		}
+
+		if err := p.updateSubscription(subscription); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to update the subscription. Please try again."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, txt), nil
+	case "channel":
+		if len(parameters) != 2 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify an option and a value.")), nil
+		}
+
+		option, value := parameters[0], parameters[1]
+
+		settings, err := p.getChannelSettings(channelID)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		if err := settings.setOption(option, value); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		if option == "window" && len(settings.Timezone) == 0 {
+			settings.Timezone = p.getUserTimezone(args.UserId)
+		}
+
+		if err := p.storeChannelSettings(channelID, settings); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to update the channel. Please try again."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Successfully set %s to %s for %s.", option, value, channelName)), nil
+	case "import":
+		if len(parameters) > 1 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify at most one post link.")), nil
+		}
+
+		postID := ""
+		if len(parameters) == 1 {
+			postID = parameters[0]
+		}
+
+		count, err := p.importOPML(args.UserId, args.ChannelId, postID)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Successfully imported %d subscriptions.", count)), nil
+	case "export":
+		channelID := args.ChannelId
+		if len(parameters) == 1 && parameters[0] == "all" {
+			if !p.API.HasPermissionTo(args.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only system admins can export the subscriptions of all channels."), nil
+			}
+			channelID = ""
+		} else if len(parameters) > 0 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, usageError(action, "Please specify `all` or nothing.")), nil
+		}
+
+		if err := p.exportOPML(args.UserId, channelID); err != nil {
+			p.API.LogError(err.Error())
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Encountered an error trying to export the subscriptions. Please try again."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "The subscriptions have been sent to you as a direct message."), nil
 	case "help":
 		text := "###### Mattermost RSSFeed Plugin - Slash Command Help\n" + strings.Replace(COMMAND_HELP, "|", "`", -1)
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, text), nil
@@ -105,3 +376,53 @@ func (p *RSSFeedPlugin) ExecuteCommand(c *plugin.Context, args *model.CommandArg
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, text), nil
 	}
 }
+
+// getUserTimezone returns the preferred time zone of a user, or an empty
+// string if it is unknown.
+func (p *RSSFeedPlugin) getUserTimezone(userID string) string {
+	user, err := p.API.GetUser(userID)
+	if err != nil {
+		return ""
+	}
+
+	timezone := user.GetPreferredTimezone()
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return ""
+	}
+	return timezone
+}
+
+// getChannelForUser looks up a ~channel name in a team, or a ~team/channel
+// name in any team, and makes sure the user may post in it.
+func (p *RSSFeedPlugin) getChannelForUser(userID string, teamID string, name string) (*model.Channel, error) {
+	var channel *model.Channel
+	var appErr *model.AppError
+	if index := strings.Index(name, "/"); index >= 0 {
+		// team-qualified as ~team/channel
+		channel, appErr = p.API.GetChannelByNameForTeamName(strings.TrimPrefix(name[:index], "~"), strings.TrimPrefix(name[index+1:], "~"), false)
+	} else {
+		channel, appErr = p.API.GetChannelByName(teamID, strings.TrimPrefix(name, "~"), false)
+	}
+	if appErr != nil {
+		return nil, fmt.Errorf("unable to find channel %s", name)
+	}
+
+	if !p.API.HasPermissionToChannel(userID, channel.Id, model.PERMISSION_CREATE_POST) {
+		return nil, fmt.Errorf("you do not have permission to post in %s", name)
+	}
+
+	return channel, nil
+}
+
+// describeRoutes lists the category routes of a subscription for /feed list.
+func (p *RSSFeedPlugin) describeRoutes(subscription *Subscription) string {
+	txt := ""
+	for category, channelID := range subscription.Routes {
+		name := channelID
+		if channel, err := p.API.GetChannel(channelID); err == nil {
+			name = "~" + channel.Name
+		}
+		txt += fmt.Sprintf("  * category `%s` to %s\n", category, name)
+	}
+	return txt
+}
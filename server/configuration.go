@@ -1,6 +1,7 @@
 package main
 
 import (
+	"net/http"
 	"reflect"
 
 	"github.com/pkg/errors"
@@ -18,15 +19,33 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
-	Heartbeat         string
-	ShowDescription   bool
-	ShowSummary       bool
-	ShowContent       bool
-	ShowRSSLink       bool
-	ShowAtomLink      bool
-	ShowRSSItemTitle  bool
-	ShowAtomItemTitle bool
-	FormatTitle       bool
+	Heartbeat            string
+	ShowDescription      bool
+	ShowSummary          bool
+	ShowContent          bool
+	ShowRSSLink          bool
+	ShowAtomLink         bool
+	ShowRSSItemTitle     bool
+	ShowAtomItemTitle    bool
+	FormatTitle          bool
+	ItemUpdateMode       string
+	MaxItemAge           string
+	MaxPostsPerCycle     string
+	MaxPostLength        string
+	LongPostMode         string
+	ManageSubscriptions  string
+	AllowedDomains       string
+	DeniedDomains        string
+	AllowedSchemes       string
+	AllowPrivateNetworks bool
+	ProxyURL             string
+	NoProxy              string
+	RootCertificates     string
+	MinTLSVersion        string
+	EncryptionKey        string
+
+	// transport is used by all requests of the plugin.
+	transport *http.Transport
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -86,7 +105,31 @@ func (p *RSSFeedPlugin) OnConfigurationChange() error {
 		return errors.Wrap(err, "failed to load plugin configuration")
 	}
 
+	// invalid HTTP settings must not discard the other settings, e.g. the
+	// permissions and domain restrictions, so the previous transport or the
+	// defaults are used instead
+	previous := p.getConfiguration()
+	transport, err := newHTTPTransport(configuration)
+	if err != nil {
+		p.API.LogError("Invalid HTTP settings, using the previous ones", "err", err.Error())
+		transport = previous.transport
+		if transport == nil || previous.AllowPrivateNetworks != configuration.AllowPrivateNetworks {
+			defaults := *configuration
+			defaults.ProxyURL, defaults.RootCertificates, defaults.MinTLSVersion = "", "", ""
+			transport, _ = newHTTPTransport(&defaults)
+		}
+	}
+	configuration.transport = transport
+
+	previousKey := previous.EncryptionKey
 	p.setConfiguration(configuration)
 
+	// re-encrypt the secrets when the encryption key is regenerated
+	if len(previousKey) > 0 && previousKey != configuration.EncryptionKey {
+		if err := p.migrateSecrets(previousKey); err != nil {
+			p.API.LogError("Failed to re-encrypt the secrets of subscriptions", "err", err.Error())
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// generateEncryptionKey returns a random key for the EncryptionKey setting.
+func generateEncryptionKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ensureEncryptionKey generates the EncryptionKey setting on the first
+// activation of the plugin.
+func (p *RSSFeedPlugin) ensureEncryptionKey() error {
+	// the active configuration is empty if it failed to load, so the stored
+	// settings are checked instead to never replace an existing key
+	stored := new(configuration)
+	if err := p.API.LoadPluginConfiguration(stored); err != nil {
+		return err
+	}
+	if len(stored.EncryptionKey) > 0 {
+		return nil
+	}
+
+	key, err := generateEncryptionKey()
+	if err != nil {
+		return err
+	}
+
+	// only add the key to the stored settings, leaving the others as they are
+	settings := p.API.GetPluginConfig()
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	for name := range settings {
+		if strings.EqualFold(name, "EncryptionKey") {
+			delete(settings, name)
+		}
+	}
+	settings["encryptionkey"] = key
+
+	if appErr := p.API.SavePluginConfig(settings); appErr != nil {
+		return appErr
+	}
+
+	configuration := p.getConfiguration().Clone()
+	configuration.EncryptionKey = key
+	p.setConfiguration(configuration)
+
+	return nil
+}
+
+func newCipher(key string) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, errors.New("the encryption key has not been generated yet")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt encrypts a secret with the EncryptionKey setting using AES-GCM.
+func (p *RSSFeedPlugin) encrypt(plaintext []byte) (string, error) {
+	return encryptWithKey(p.getConfiguration().EncryptionKey, plaintext)
+}
+
+// decrypt decrypts a secret encrypted with encrypt.
+func (p *RSSFeedPlugin) decrypt(ciphertext string) ([]byte, error) {
+	return decryptWithKeys(ciphertext, p.getConfiguration().EncryptionKey)
+}
+
+func encryptWithKey(key string, plaintext []byte) (string, error) {
+	aead, err := newCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// decryptWithKeys decrypts a secret with the first of the keys that fits.
+func decryptWithKeys(ciphertext string, keys ...string) ([]byte, error) {
+	plaintext, _, err := decryptWithKeyIndex(ciphertext, keys...)
+	return plaintext, err
+}
+
+// decryptWithKeyIndex is decryptWithKeys, also returning the index of the key
+// that fit.
+func decryptWithKeyIndex(ciphertext string, keys ...string) ([]byte, int, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, -1, errors.New("invalid encrypted secret")
+	}
+
+	for i, key := range keys {
+		aead, err := newCipher(key)
+		if err != nil {
+			continue
+		}
+		if len(data) < aead.NonceSize() {
+			return nil, -1, errors.New("invalid encrypted secret")
+		}
+		if plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil); err == nil {
+			return plaintext, i, nil
+		}
+	}
+
+	return nil, -1, errors.New("unable to decrypt secret, the encryption key may have changed")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	encrypted, err := encryptWithKey("key", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, "secret") {
+		t.Errorf("the secret is readable in %s", encrypted)
+	}
+	if again, _ := encryptWithKey("key", []byte("secret")); again == encrypted {
+		t.Errorf("encrypting twice gave the same ciphertext")
+	}
+
+	if plaintext, err := decryptWithKeys(encrypted, "key"); err != nil || string(plaintext) != "secret" {
+		t.Errorf("got %q, %v", plaintext, err)
+	}
+	if plaintext, index, err := decryptWithKeyIndex(encrypted, "new key", "key"); err != nil || string(plaintext) != "secret" || index != 1 {
+		t.Errorf("decrypting with the previous key: got %q, %d, %v", plaintext, index, err)
+	}
+
+	if _, err := decryptWithKeys(encrypted, "wrong key"); err == nil {
+		t.Errorf("decrypting with a wrong key succeeded")
+	}
+	if _, err := decryptWithKeys(encrypted, ""); err == nil {
+		t.Errorf("decrypting without a key succeeded")
+	}
+	if _, err := decryptWithKeys("not base64!", "key"); err == nil {
+		t.Errorf("decrypting an invalid secret succeeded")
+	}
+	if _, err := decryptWithKeys("c2hvcnQ=", "key"); err == nil {
+		t.Errorf("decrypting a truncated secret succeeded")
+	}
+	if _, err := encryptWithKey("", []byte("secret")); err == nil {
+		t.Errorf("encrypting without a key succeeded")
+	}
+
+	p, _ := newTestPlugin()
+	if _, err := p.encrypt([]byte("secret")); err == nil {
+		t.Errorf("encrypting before the key was generated succeeded")
+	}
+}
+
+func TestEnsureEncryptionKey(t *testing.T) {
+	p, api := newTestPlugin()
+	api.pluginConfig = map[string]interface{}{"heartbeat": "5"}
+
+	if err := p.ensureEncryptionKey(); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := api.pluginConfig["encryptionkey"].(string)
+	if len(key) == 0 || p.getConfiguration().EncryptionKey != key {
+		t.Fatalf("expected a key to be generated, got %v", api.pluginConfig)
+	}
+	if api.pluginConfig["heartbeat"] != "5" {
+		t.Errorf("the other settings were not kept: %v", api.pluginConfig)
+	}
+
+	// an existing key is kept even if the active configuration lacks it
+	p.setConfiguration(&configuration{})
+	if err := p.ensureEncryptionKey(); err != nil {
+		t.Fatal(err)
+	}
+	if api.pluginConfig["encryptionkey"] != key {
+		t.Errorf("the stored key was replaced: %v", api.pluginConfig)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseDuration parses a Go duration such as 12h, also accepting a number of
+// days such as 7d.
+func parseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid duration %s, expected e.g. 12h or 7d", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %s, expected e.g. 12h or 7d", value)
+	}
+	return duration, nil
+}
+
+// normalizeLink reduces a link to a form that is shared by the copies of an
+// article published by different feeds.
+func normalizeLink(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || len(u.Host) == 0 {
+		return strings.ToLower(strings.TrimSpace(link))
+	}
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	normalized := host + path
+	if encoded := query.Encode(); len(encoded) > 0 {
+		normalized = normalized + "?" + encoded
+	}
+	return normalized
+}
+
+// normalizeTitle lower cases a title and collapses its whitespace.
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+func getSeenItemsKey(channelID string) string {
+	return fmt.Sprintf("seen_%s", channelID)
+}
+
+// getDedupeWindow returns the dedupe window of a channel, or zero if items
+// are not deduplicated in it.
+func (p *RSSFeedPlugin) getDedupeWindow(channelID string) time.Duration {
+	settings, err := p.getChannelSettings(channelID)
+	if err != nil {
+		p.API.LogError(err.Error())
+		return 0
+	}
+
+	if len(settings.Dedupe) == 0 {
+		return 0
+	}
+
+	window, err := parseDuration(settings.Dedupe)
+	if err != nil {
+		p.API.LogError(err.Error())
+		return 0
+	}
+	return window
+}
+
+// dedupeKeys returns the normalized link and title of an item.
+func dedupeKeys(item *feedItem) []string {
+	keys := []string{}
+	if len(item.Link) > 0 {
+		keys = append(keys, "link:"+normalizeLink(item.Link))
+	}
+	if title := normalizeTitle(item.Title); len(title) > 0 {
+		keys = append(keys, "title:"+title)
+	}
+	return keys
+}
+
+// getSeenItems returns when the items seen in a channel were posted, by their
+// dedupe keys.
+func (p *RSSFeedPlugin) getSeenItems(channelID string) (map[string]int64, error) {
+	seen := map[string]int64{}
+	value, appErr := p.API.KVGet(getSeenItemsKey(channelID))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if value != nil {
+		json.NewDecoder(bytes.NewReader(value)).Decode(&seen)
+	}
+	return seen, nil
+}
+
+// isDuplicate reports whether an item with the same link or title has been
+// posted to a channel within the channel's dedupe window.
+func (p *RSSFeedPlugin) isDuplicate(channelID string, item *feedItem, now time.Time) bool {
+	window := p.getDedupeWindow(channelID)
+	if window == 0 {
+		return false
+	}
+
+	seen, err := p.getSeenItems(channelID)
+	if err != nil {
+		p.API.LogError(err.Error())
+		return false
+	}
+
+	oldest := now.Add(-window).UnixNano() / int64(time.Millisecond)
+	for _, key := range dedupeKeys(item) {
+		if seenAt, ok := seen[key]; ok && seenAt >= oldest {
+			return true
+		}
+	}
+	return false
+}
+
+// markSeen remembers an item posted to a channel, so that duplicates of it
+// are suppressed there. Items are only remembered once they are posted, as
+// their duplicates must not be suppressed if they are never posted.
+func (p *RSSFeedPlugin) markSeen(channelID string, item *feedItem, now time.Time) {
+	window := p.getDedupeWindow(channelID)
+	keys := dedupeKeys(item)
+	if window == 0 || len(keys) == 0 {
+		return
+	}
+
+	seen, err := p.getSeenItems(channelID)
+	if err != nil {
+		p.API.LogError(err.Error())
+		return
+	}
+
+	nowMillis := now.UnixNano() / int64(time.Millisecond)
+	oldest := now.Add(-window).UnixNano() / int64(time.Millisecond)
+	for key, seenAt := range seen {
+		if seenAt < oldest {
+			delete(seen, key)
+		}
+	}
+
+	for _, key := range keys {
+		seen[key] = nowMillis
+	}
+
+	b, err := json.Marshal(seen)
+	if err != nil {
+		p.API.LogError(err.Error())
+		return
+	}
+	if appErr := p.API.KVSet(getSeenItemsKey(channelID), b); appErr != nil {
+		p.API.LogError(appErr.Error())
+	}
+}
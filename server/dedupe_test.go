@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func TestNormalizeLink(t *testing.T) {
+	for link, expected := range map[string]string{
+		"https://www.Example.com/post/":                 "example.com/post",
+		"http://example.com/post?utm_source=rss&id=1":   "example.com/post?id=1",
+		"https://example.com/post?UTM_Medium=feed":      "example.com/post",
+		" https://example.com/a%20b ":                   "example.com/a%20b",
+		"urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a": "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+		"HTTPS://EXAMPLE.COM/Post?b=2&a=1":              "example.com/Post?a=1&b=2",
+	} {
+		if normalized := normalizeLink(link); normalized != expected {
+			t.Errorf("normalizing %s: got %s, want %s", link, normalized, expected)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"12h": 12 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"90m": 90 * time.Minute,
+		"0d":  0,
+		"-1h": 0,
+		"d":   0,
+		"abc": 0,
+	} {
+		duration, err := parseDuration(value)
+		if expected == 0 {
+			if err == nil {
+				t.Errorf("expected %s to be invalid, got %v", value, duration)
+			}
+			continue
+		}
+		if err != nil || duration != expected {
+			t.Errorf("parsing %s: got %v, %v, want %v", value, duration, err, expected)
+		}
+	}
+}
+
+func newDedupeTest(t *testing.T) (*RSSFeedPlugin, *testAPI, *Subscription, *Subscription) {
+	p, api := newTestPlugin()
+	if err := p.storeChannelSettings("channel", &ChannelSettings{Dedupe: "7d"}); err != nil {
+		t.Fatal(err)
+	}
+	first := &Subscription{ChannelID: "channel", URL: "https://example.com/first"}
+	second := &Subscription{ChannelID: "channel", URL: "https://example.org/second"}
+	return p, api, first, second
+}
+
+func TestDuplicatesOfPostedItemsAreSuppressed(t *testing.T) {
+	p, api, first, second := newDedupeTest(t)
+
+	p.deliverItems(first, []*feedItem{{Key: "1", Title: "News", Link: "https://example.com/news?utm_source=first", Message: "first"}})
+	p.deliverItems(second, []*feedItem{{Key: "2", Title: "Other title", Link: "https://www.example.com/news", Message: "second"}})
+	p.deliverItems(second, []*feedItem{{Key: "3", Title: "  NEWS ", Link: "https://example.net/copy", Message: "third"}})
+
+	if len(api.created) != 1 || api.created[0].Message != "first" {
+		t.Errorf("expected the duplicates to be suppressed, got %v", api.created)
+	}
+
+	// after the dedupe window the item is posted again
+	if p.isDuplicate("channel", &feedItem{Title: "News"}, time.Now().Add(8*24*time.Hour)) {
+		t.Errorf("the item is still a duplicate after the dedupe window")
+	}
+}
+
+func TestDuplicatesOfItemsNotPostedAreDelivered(t *testing.T) {
+	p, api, first, second := newDedupeTest(t)
+
+	// limited to a single post, the second item only appears in the overflow
+	first.MaxPosts = 1
+	p.deliverItems(first, []*feedItem{
+		{Key: "1", Title: "One", Link: "https://example.com/1", Message: "one"},
+		{Key: "2", Title: "Two", Link: "https://example.com/2", Message: "two"},
+	})
+
+	// the post of this item fails
+	api.failPosts = func(post *model.Post) bool { return post.Message == "three" }
+	p.deliverItems(first, []*feedItem{{Key: "3", Title: "Three", Link: "https://example.com/3", Message: "three"}})
+	api.failPosts = nil
+
+	p.deliverItems(second, []*feedItem{
+		{Key: "2", Title: "Two", Link: "https://example.com/2", Message: "two again"},
+		{Key: "3", Title: "Three", Link: "https://example.com/3", Message: "three again"},
+	})
+
+	posted := []string{}
+	for _, post := range api.created {
+		posted = append(posted, post.Message)
+	}
+	if len(posted) != 4 || posted[2] != "two again" || posted[3] != "three again" {
+		t.Errorf("expected the duplicates of items that were not posted to be delivered, got %q", posted)
+	}
+}
+
+func TestDuplicatesOfDigestItemsAreSuppressedOncePosted(t *testing.T) {
+	p, api, first, second := newDedupeTest(t)
+	first.Digest = "daily@09:00"
+
+	p.deliverItems(first, []*feedItem{{Key: "1", Title: "News", Link: "https://example.com/news", Message: "news"}})
+	if p.isDuplicate("channel", &feedItem{Link: "https://example.com/news"}, time.Now()) {
+		t.Fatalf("an item queued for the digest is a duplicate before the digest is posted")
+	}
+
+	if err := p.flushDigest(first, "daily"); err != nil {
+		t.Fatal(err)
+	}
+	p.deliverItems(second, []*feedItem{{Key: "2", Title: "News", Link: "https://example.com/news", Message: "news again"}})
+	if len(api.created) != 1 {
+		t.Errorf("expected only the digest to be posted, got %v", api.created)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// feedItem is the format independent representation of a new feed item.
+type feedItem struct {
+	// Key identifies the item within its feed.
+	Key       string
+	FeedTitle string
+	Title     string
+	Link      string
+	// Content is the description, summary or content of the item as found
+	// in the feed.
+	Content    string
+	Categories []string
+	Author     string
+	// Published is the date the item was published or last updated, or the
+	// zero time if the feed does not tell.
+	Published time.Time
+	// Message is the rendered post of the item.
+	Message string
+
+	// format renders Message if it is only needed once the item is accepted,
+	// as it may fetch the full article.
+	format func() string
+}
+
+// renderMessage renders the message of an item that is formatted lazily.
+func (item *feedItem) renderMessage() {
+	if item.format != nil {
+		item.Message = item.format()
+		item.format = nil
+	}
+}
+
+// deliverItems delivers the new items of a subscription found in one cycle to
+// the subscribed channel and the channels of its routes.
+func (p *RSSFeedPlugin) deliverItems(subscription *Subscription, items []*feedItem) {
+	channelIDs := []string{}
+	channelItems := map[string][]*feedItem{}
+	for _, item := range items {
+		accepted := p.acceptItem(subscription, item)
+		if len(accepted) == 0 {
+			continue
+		}
+		item.renderMessage()
+		for _, channelID := range accepted {
+			if _, ok := channelItems[channelID]; !ok {
+				channelIDs = append(channelIDs, channelID)
+			}
+			channelItems[channelID] = append(channelItems[channelID], item)
+		}
+	}
+
+	for _, channelID := range channelIDs {
+		target := subscription.routedTo(channelID)
+		p.deliverChannelItems(target, channelItems[channelID])
+		subscription.updateRoute(target)
+	}
+}
+
+// deliverChannelItems delivers the new items of one cycle to the channel of a
+// subscription. Once the maximum number of posts per cycle is reached, the
+// remaining items are collapsed into a single overflow post.
+func (p *RSSFeedPlugin) deliverChannelItems(subscription *Subscription, items []*feedItem) {
+	// digests collect all items into one post anyway, and queued items are
+	// limited once the delivery window opens
+	if subscription.Digest == digestOff && p.isDeliveryOpen(subscription, time.Now()) {
+		items = p.limitItems(subscription, items)
+	}
+
+	for _, item := range items {
+		p.deliverItem(subscription, item)
+	}
+}
+
+// limitItems returns the items to post at once, replacing the items beyond
+// the maximum number of posts per cycle by a single overflow post.
+func (p *RSSFeedPlugin) limitItems(subscription *Subscription, items []*feedItem) []*feedItem {
+	maxPosts := p.getMaxPostsPerCycle(subscription)
+	if maxPosts <= 0 || len(items) <= maxPosts {
+		return items
+	}
+
+	overflow := items[maxPosts:]
+	return append(items[:maxPosts:maxPosts], &feedItem{
+		FeedTitle: overflow[0].FeedTitle,
+		Message:   p.formatOverflow(overflow),
+	})
+}
+
+// acceptItem returns the channels a new item should be delivered to, which
+// are the channels routed to its categories or else the subscribed channel.
+// Items that are too old or do not pass the subscription's filters and
+// categories are dropped, and items already delivered to a channel by another
+// subscription are suppressed there.
+func (p *RSSFeedPlugin) acceptItem(subscription *Subscription, item *feedItem) []string {
+	if p.isTooOld(subscription, item, time.Now()) {
+		p.API.LogDebug("Skipped feed item older than the maximum age",
+			"subscription_url", redactURL(subscription.URL),
+			"item_title", item.Title)
+		return nil
+	}
+
+	if !subscription.matchesFilters(item) || !subscription.matchesCategories(item) {
+		return nil
+	}
+
+	channelIDs := subscription.routeChannelIDs(item)
+	if len(channelIDs) == 0 {
+		channelIDs = []string{subscription.ChannelID}
+	}
+
+	accepted := []string{}
+	for _, channelID := range channelIDs {
+		if p.isDuplicate(channelID, item, time.Now()) {
+			p.API.LogDebug("Suppressed duplicate feed item",
+				"subscription_url", redactURL(subscription.URL),
+				"channel_id", channelID,
+				"item_title", item.Title)
+			continue
+		}
+		accepted = append(accepted, channelID)
+	}
+	return accepted
+}
+
+// deliverItem posts an item to the subscribed channel, or queues it for the
+// next digest or until the delivery window opens.
+func (p *RSSFeedPlugin) deliverItem(subscription *Subscription, item *feedItem) {
+	if subscription.Digest != digestOff {
+		if err := p.queueDigestItem(subscription, item); err != nil {
+			p.API.LogError(err.Error())
+		}
+		return
+	}
+
+	if !p.isDeliveryOpen(subscription, time.Now()) {
+		if err := p.queueItem(subscription, item); err != nil {
+			p.API.LogError(err.Error())
+		}
+		return
+	}
+
+	p.postItem(subscription, item)
+}
+
+// getMaxPostsPerCycle returns the maximum number of items of the subscription
+// posted in one cycle, or zero if there is no limit.
+func (p *RSSFeedPlugin) getMaxPostsPerCycle(subscription *Subscription) int {
+	if subscription.MaxPosts > 0 {
+		return subscription.MaxPosts
+	}
+
+	maxPosts, _ := strconv.Atoi(p.getConfiguration().MaxPostsPerCycle)
+	if maxPosts < 0 {
+		return 0
+	}
+	return maxPosts
+}
+
+func (p *RSSFeedPlugin) formatOverflow(items []*feedItem) string {
+	post := ""
+	if p.getConfiguration().FormatTitle {
+		post = post + "##### "
+	}
+	post = post + items[0].FeedTitle + "\n"
+
+	if len(items) == 1 {
+		post = post + "_...and 1 more item_\n"
+	} else {
+		post = post + fmt.Sprintf("_...and %d more items_\n", len(items))
+	}
+
+	for _, item := range items {
+		post = post + formatItemLink(item.Title, item.Link)
+	}
+
+	return post
+}
+
+// postItem posts a feed item and remembers the post for later updates.
+func (p *RSSFeedPlugin) postItem(subscription *Subscription, item *feedItem) {
+	post, err := p.createItemPost(subscription, item.FeedTitle, item.Message, item.Link)
+	if err != nil {
+		p.API.LogError("Unable to post a feed item",
+			"subscription_url", redactURL(subscription.URL),
+			"channel_id", subscription.ChannelID,
+			"item_title", item.Title,
+			"err", err.Error())
+		return
+	}
+	if len(item.Key) > 0 {
+		subscription.setPostID(item.Key, post.Id)
+	}
+	p.markSeen(subscription.ChannelID, item, time.Now())
+}
+
+// createItemPost posts a message to the subscribed channel. For threaded
+// subscriptions the message is posted as a reply to the feed's current root
+// post, and a new root post is created if replying to the current one fails,
+// e.g. because it was deleted. Messages exceeding the maximum post length are truncated, or split
+// into replies to the first part.
+func (p *RSSFeedPlugin) createItemPost(subscription *Subscription, feedTitle string, message string, link string) (*model.Post, error) {
+	parts := p.splitMessage(message, link)
+
+	rootID, previousRootID := "", subscription.RootPostID
+	if subscription.Thread != threadOff {
+		var err error
+		rootID, err = p.ensureRootPost(subscription, feedTitle, time.Now().In(subscription.location()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	post, err := p.createBotReply(subscription.ChannelID, rootID, parts[0], "custom_git_pr")
+	if err != nil && len(rootID) > 0 && rootID == previousRootID {
+		// the root post may have been deleted, so start a new thread
+		subscription.RootPostID = ""
+		subscription.RootPostCreated = 0
+		if rootID, err = p.ensureRootPost(subscription, feedTitle, time.Now().In(subscription.location())); err != nil {
+			return nil, err
+		}
+		post, err = p.createBotReply(subscription.ChannelID, rootID, parts[0], "custom_git_pr")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rootID) == 0 {
+		rootID = post.Id
+	}
+	for _, part := range parts[1:] {
+		if _, err := p.createBotReply(subscription.ChannelID, rootID, part, "custom_git_pr"); err != nil {
+			break
+		}
+	}
+
+	return post, nil
+}
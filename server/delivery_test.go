@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSubscription(p *RSSFeedPlugin, subscription *Subscription) *Subscription {
+	s := &Subscriptions{Subscriptions: map[string]*Subscription{
+		getKey(subscription.ChannelID, subscription.URL): subscription,
+	}}
+	if err := p.storeSubscriptions(s); err != nil {
+		panic(err)
+	}
+	return subscription
+}
+
+func TestDeliverItemsRoutes(t *testing.T) {
+	p, api := newTestPlugin()
+	subscription := newTestSubscription(p, &Subscription{
+		ChannelID: "subscribed",
+		URL:       "https://example.com/feed",
+		Routes:    map[string]string{"go": "routed"},
+		MaxPosts:  1,
+	})
+
+	p.deliverItems(subscription, []*feedItem{
+		{Key: "a", Title: "A", Link: "https://example.com/a", Categories: []string{"Go"}, Message: "item a"},
+		{Key: "b", Title: "B", Link: "https://example.com/b", Categories: []string{"go"}, Message: "item b"},
+		{Key: "c", Title: "C", Link: "https://example.com/c", Message: "item c"},
+	})
+
+	subscribed := api.channelPosts("subscribed")
+	if len(subscribed) != 1 || subscribed[0].Message != "item c" {
+		t.Fatalf("unexpected posts in the subscribed channel: %v", subscribed)
+	}
+
+	routed := api.channelPosts("routed")
+	if len(routed) != 2 || routed[0].Message != "item a" || !strings.Contains(routed[1].Message, "[B](https://example.com/b)") {
+		t.Fatalf("expected the routed items to be limited, got %v", routed)
+	}
+
+	if subscription.PostIDs["a"] != routed[0].Id || subscription.PostIDs["c"] != subscribed[0].Id {
+		t.Errorf("the posts of the items were not remembered: %v", subscription.PostIDs)
+	}
+}
+
+func TestDeliverItemsRoutedWindowAndDedupe(t *testing.T) {
+	p, api := newTestPlugin()
+	subscription := newTestSubscription(p, &Subscription{
+		ChannelID: "subscribed",
+		URL:       "https://example.com/feed",
+		Routes:    map[string]string{"go": "routed"},
+	})
+	// an empty window never opens
+	if err := p.storeChannelSettings("routed", &ChannelSettings{Window: "00:00-00:00", Dedupe: "7d"}); err != nil {
+		t.Fatal(err)
+	}
+
+	item := func() *feedItem {
+		return &feedItem{Key: "a", Title: "A", Link: "https://example.com/a", Categories: []string{"go"}, Message: "item a"}
+	}
+
+	p.deliverItems(subscription, []*feedItem{item()})
+	if len(api.created) != 0 {
+		t.Fatalf("expected the routed item to be queued, got %v", api.created)
+	}
+
+	if err := p.storeChannelSettings("routed", &ChannelSettings{Dedupe: "7d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.processQueue(subscription, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	routed := api.channelPosts("routed")
+	if len(routed) != 1 || routed[0].Message != "item a" {
+		t.Fatalf("expected the queued item to be posted once the window opened, got %v", routed)
+	}
+
+	// the same article from another feed is suppressed in the routed channel
+	duplicate := item()
+	duplicate.Key = "other"
+	p.deliverItems(subscription, []*feedItem{duplicate})
+	if len(api.created) != 1 {
+		t.Errorf("expected the duplicate to be suppressed, got %v", api.created)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Digest periods of the digest subscription option.
+const (
+	digestOff    = ""
+	digestHourly = "hourly"
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// digestSchedule is the parsed form of a digest option such as daily@09:00.
+// Hourly digests only use the minute, weekly digests are posted on Mondays.
+type digestSchedule struct {
+	Period string
+	Hour   int
+	Minute int
+}
+
+// digestEntry is a feed item waiting in the KV store for the next digest.
+type digestEntry struct {
+	FeedTitle string
+	Title     string
+	Link      string
+}
+
+func parseDigestSchedule(value string) (*digestSchedule, error) {
+	schedule := &digestSchedule{Hour: 9}
+	period := value
+	at := ""
+	if i := strings.Index(value, "@"); i >= 0 {
+		period, at = value[:i], value[i+1:]
+	}
+
+	switch period {
+	case digestHourly, digestDaily, digestWeekly:
+		schedule.Period = period
+	default:
+		return nil, fmt.Errorf("invalid digest value %s, expected hourly, daily or weekly with an optional @HH:MM", value)
+	}
+
+	if period == digestHourly {
+		schedule.Hour = 0
+	}
+
+	if len(at) > 0 {
+		parts := strings.Split(at, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid digest time %s, expected HH:MM", at)
+		}
+		hour, err := strconv.Atoi(parts[0])
+		if err != nil || hour < 0 || hour > 23 {
+			return nil, fmt.Errorf("invalid digest time %s, expected HH:MM", at)
+		}
+		minute, err := strconv.Atoi(parts[1])
+		if err != nil || minute < 0 || minute > 59 {
+			return nil, fmt.Errorf("invalid digest time %s, expected HH:MM", at)
+		}
+		schedule.Hour = hour
+		schedule.Minute = minute
+	}
+
+	return schedule, nil
+}
+
+// lastDue returns the most recent time at or before now at which a digest
+// was scheduled to be posted.
+func (s *digestSchedule) lastDue(now time.Time) time.Time {
+	switch s.Period {
+	case digestHourly:
+		// counting back from now keeps the repeated hour at the end of
+		// daylight saving time, which time.Date would skip
+		minutes := (now.Minute() - s.Minute + 60) % 60
+		return now.Add(-time.Duration(minutes)*time.Minute - time.Duration(now.Second())*time.Second - time.Duration(now.Nanosecond()))
+	case digestWeekly:
+		start := periodStart(threadWeekly, now)
+		due := time.Date(start.Year(), start.Month(), start.Day(), s.Hour, s.Minute, 0, 0, now.Location())
+		if due.After(now) {
+			due = due.AddDate(0, 0, -7)
+		}
+		return due
+	default:
+		due := time.Date(now.Year(), now.Month(), now.Day(), s.Hour, s.Minute, 0, 0, now.Location())
+		if due.After(now) {
+			due = due.AddDate(0, 0, -1)
+		}
+		return due
+	}
+}
+
+func getDigestKey(subscription *Subscription) string {
+	return fmt.Sprintf("digest_%x", md5.Sum([]byte(getKey(subscription.ChannelID, subscription.URL))))
+}
+
+func (p *RSSFeedPlugin) getDigestEntries(subscription *Subscription) ([]*digestEntry, error) {
+	entries := []*digestEntry{}
+
+	value, err := p.API.KVGet(getDigestKey(subscription))
+	if err != nil {
+		return nil, err
+	}
+
+	if value != nil {
+		json.NewDecoder(bytes.NewReader(value)).Decode(&entries)
+	}
+
+	return entries, nil
+}
+
+func (p *RSSFeedPlugin) queueDigestItem(subscription *Subscription, item *feedItem) error {
+	entries, err := p.getDigestEntries(subscription)
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries, &digestEntry{FeedTitle: item.FeedTitle, Title: item.Title, Link: item.Link})
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	if err := p.API.KVSet(getDigestKey(subscription), b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// processDigest posts the queued items of a digest subscription once the
+// scheduled time has passed in the subscription's time zone and the delivery
+// window is open. The digests of the channels of routes are posted at the
+// same time, unless their delivery window is closed.
+func (p *RSSFeedPlugin) processDigest(subscription *Subscription, now time.Time) error {
+	if subscription.Digest == digestOff {
+		return nil
+	}
+
+	schedule, err := parseDigestSchedule(subscription.Digest)
+	if err != nil {
+		return err
+	}
+
+	due := schedule.lastDue(now.In(subscription.location()))
+	if subscription.DigestLastSent >= due.UnixNano()/int64(time.Millisecond) || !p.isDeliveryOpen(subscription, now) {
+		return nil
+	}
+
+	for _, target := range subscription.deliveryTargets() {
+		if target == subscription {
+			if err := p.flushDigest(subscription, schedule.Period); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !p.isDeliveryOpen(target, now) {
+			continue
+		}
+		if err := p.flushDigest(target, schedule.Period); err != nil {
+			p.API.LogError("Unable to post the digest of a route",
+				"subscription_url", redactURL(subscription.URL),
+				"channel_id", target.ChannelID,
+				"err", err.Error())
+			continue
+		}
+		subscription.updateRoute(target)
+	}
+
+	subscription.DigestLastSent = now.UnixNano() / int64(time.Millisecond)
+	return p.updateSubscriptionState(subscription)
+}
+
+// flushDigest posts all queued items of a subscription as one digest post.
+func (p *RSSFeedPlugin) flushDigest(subscription *Subscription, period string) error {
+	entries, err := p.getDigestEntries(subscription)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	feedTitle := entries[len(entries)-1].FeedTitle
+	if _, err := p.createItemPost(subscription, feedTitle, p.formatDigest(feedTitle, period, entries), ""); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		p.markSeen(subscription.ChannelID, &feedItem{Title: entry.Title, Link: entry.Link}, time.Now())
+	}
+
+	if err := p.API.KVDelete(getDigestKey(subscription)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *RSSFeedPlugin) formatDigest(feedTitle string, period string, entries []*digestEntry) string {
+	post := ""
+	if p.getConfiguration().FormatTitle {
+		post = post + "##### "
+	}
+	post = post + feedTitle + "\n"
+
+	label := "Digest"
+	if len(period) > 0 {
+		label = strings.ToUpper(period[:1]) + period[1:] + " digest"
+	}
+	if len(entries) == 1 {
+		post = post + fmt.Sprintf("_%s: 1 new item_\n", label)
+	} else {
+		post = post + fmt.Sprintf("_%s: %d new items_\n", label, len(entries))
+	}
+
+	for _, entry := range entries {
+		post = post + formatItemLink(entry.Title, entry.Link)
+	}
+
+	return post
+}
+
+// formatItemLink renders an item as a markdown list entry linking to it.
+func formatItemLink(title string, link string) string {
+	if len(title) == 0 {
+		title = link
+	}
+
+	if len(link) > 0 {
+		return fmt.Sprintf("* [%s](%s)\n", title, link)
+	}
+	return fmt.Sprintf("* %s\n", title)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDigestSchedule(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected digestSchedule
+	}{
+		{"hourly", digestSchedule{Period: digestHourly}},
+		{"hourly@00:15", digestSchedule{Period: digestHourly, Minute: 15}},
+		{"daily", digestSchedule{Period: digestDaily, Hour: 9}},
+		{"daily@17:30", digestSchedule{Period: digestDaily, Hour: 17, Minute: 30}},
+		{"weekly", digestSchedule{Period: digestWeekly, Hour: 9}},
+		{"weekly@0:05", digestSchedule{Period: digestWeekly, Minute: 5}},
+	} {
+		schedule, err := parseDigestSchedule(test.value)
+		if err != nil {
+			t.Errorf("parsing %q: %v", test.value, err)
+			continue
+		}
+		if *schedule != test.expected {
+			t.Errorf("parsing %q: got %+v, want %+v", test.value, *schedule, test.expected)
+		}
+	}
+
+	for _, value := range []string{"", "monthly", "Daily", "daily@9", "daily@24:00", "daily@09:60", "weekly@-1:00", "daily@a:b"} {
+		if schedule, err := parseDigestSchedule(value); err == nil {
+			t.Errorf("expected parsing %q to fail, got %+v", value, schedule)
+		}
+	}
+}
+
+func TestDigestScheduleLastDue(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	local := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2021, month, day, hour, minute, 0, 0, newYork)
+	}
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2021, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, test := range []struct {
+		schedule string
+		now      time.Time
+		expected time.Time
+	}{
+		{"hourly", local(time.March, 5, 10, 0), local(time.March, 5, 10, 0)},
+		{"hourly@00:30", local(time.March, 5, 10, 29), local(time.March, 5, 9, 30)},
+		{"hourly@00:30", local(time.March, 5, 0, 10), local(time.March, 4, 23, 30)},
+		// daylight saving time starts at 2:00 EST on March 14 and ends at
+		// 2:00 EDT on November 7
+		{"hourly@00:30", local(time.March, 14, 3, 10), utc(time.March, 14, 6, 30)},
+		{"hourly@00:30", utc(time.November, 7, 5, 40).In(newYork), utc(time.November, 7, 5, 30)},
+		{"hourly@00:30", utc(time.November, 7, 6, 40).In(newYork), utc(time.November, 7, 6, 30)},
+		{"daily@09:00", local(time.March, 5, 9, 0), local(time.March, 5, 9, 0)},
+		{"daily@09:00", local(time.March, 5, 8, 59), local(time.March, 4, 9, 0)},
+		{"daily@09:00", local(time.March, 14, 8, 0), utc(time.March, 13, 14, 0)},
+		{"daily@09:00", local(time.March, 14, 10, 0), utc(time.March, 14, 13, 0)},
+		{"daily@09:00", local(time.November, 7, 8, 0), utc(time.November, 6, 13, 0)},
+		{"daily@09:00", local(time.January, 1, 8, 0), local(time.December, 31, 9, 0).AddDate(-1, 0, 0)},
+		// weeks start on Monday; March 15, 2021 is a Monday
+		{"weekly@09:00", local(time.March, 15, 9, 30), local(time.March, 15, 9, 0)},
+		{"weekly@09:00", local(time.March, 21, 23, 59), local(time.March, 15, 9, 0)},
+		{"weekly@09:00", local(time.March, 15, 8, 0), utc(time.March, 8, 14, 0)},
+		{"weekly@09:00", local(time.March, 14, 23, 0), utc(time.March, 8, 14, 0)},
+		{"weekly", local(time.January, 3, 12, 0), local(time.December, 28, 9, 0).AddDate(-1, 0, 0)},
+	} {
+		schedule, err := parseDigestSchedule(test.schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := schedule.lastDue(test.now); !actual.Equal(test.expected) {
+			t.Errorf("%s at %v: got %v, want %v", test.schedule, test.now, actual, test.expected)
+		}
+	}
+}
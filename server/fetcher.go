@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Limits of the requests of the plugin.
+const (
+	fetchTimeout = 30 * time.Second
+	feedMaxBytes = 10 * 1024 * 1024
+	maxRedirects = 10
+)
+
+// defaultAllowedSchemes are the URL schemes that can be fetched unless the
+// AllowedSchemes setting says otherwise.
+var defaultAllowedSchemes = []string{"http", "https"}
+
+// privateNetworks are the address ranges that can't be fetched unless the
+// AllowPrivateNetworks setting is enabled, to keep users from reaching
+// internal services and cloud metadata endpoints through the plugin.
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",      // this network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade NAT
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, including cloud metadata
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, including broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // IPv4/IPv6 translation
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a setting of comma or whitespace separated values.
+func splitList(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// matchesDomain reports whether a host is one of the domains or a subdomain
+// of one of them. A leading *. of a domain is optional.
+func matchesDomain(host string, domains []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(domain, "*.")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFetchURL makes sure a URL may be fetched according to the allowed
+// schemes and the allowed and denied domains. Addresses are checked again
+// after DNS resolution when connecting.
+func (p *RSSFeedPlugin) checkFetchURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url %s", rawURL)
+	}
+
+	config := p.getConfiguration()
+
+	schemes := splitList(config.AllowedSchemes)
+	if len(schemes) == 0 {
+		schemes = defaultAllowedSchemes
+	}
+	allowed := false
+	for _, scheme := range schemes {
+		allowed = allowed || strings.ToLower(u.Scheme) == scheme
+	}
+	if !allowed {
+		return fmt.Errorf("the scheme of %s is not allowed, use one of %s", rawURL, strings.Join(schemes, ", "))
+	}
+
+	host := u.Hostname()
+	if len(host) == 0 {
+		return fmt.Errorf("invalid url %s", rawURL)
+	}
+
+	if matchesDomain(host, splitList(config.DeniedDomains)) {
+		return fmt.Errorf("the domain of %s is not allowed", rawURL)
+	}
+	if allowedDomains := splitList(config.AllowedDomains); len(allowedDomains) > 0 && !matchesDomain(host, allowedDomains) {
+		return fmt.Errorf("the domain of %s is not allowed", rawURL)
+	}
+
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) && !config.AllowPrivateNetworks {
+		return fmt.Errorf("the address of %s is not allowed", rawURL)
+	}
+
+	return nil
+}
+
+// Values of the MinTLSVersion setting.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newHTTPTransport returns the transport of all requests of the plugin,
+// configured with the proxy, root certificates and minimum TLS version of
+// the settings. It refuses to connect to private addresses, as resolved when
+// connecting, unless they are allowed.
+func newHTTPTransport(config *configuration) (*http.Transport, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(config.MinTLSVersion) > 0 {
+		version, ok := tlsVersions[config.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid minimum TLS version %s", config.MinTLSVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(strings.TrimSpace(config.RootCertificates)) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM([]byte(config.RootCertificates)) {
+			return nil, errors.New("no valid PEM certificates in the root certificates")
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	var proxyURL *url.URL
+	if len(strings.TrimSpace(config.ProxyURL)) > 0 {
+		var err error
+		if proxyURL, err = url.Parse(strings.TrimSpace(config.ProxyURL)); err != nil || len(proxyURL.Host) == 0 {
+			return nil, fmt.Errorf("invalid proxy URL %s", config.ProxyURL)
+		}
+		if len(proxyURL.Port()) == 0 {
+			port := "80"
+			if proxyURL.Scheme == "https" {
+				port = "443"
+			}
+			proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), port)
+		}
+	}
+	noProxy := splitList(config.NoProxy)
+
+	dialer := &net.Dialer{Timeout: fetchTimeout}
+	guardedDialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return fmt.Errorf("connecting to %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if proxyURL == nil || matchesDomain(req.URL.Hostname(), noProxy) {
+				return nil, nil
+			}
+			// the proxy resolves the host, so it has to be checked here
+			if !config.AllowPrivateNetworks {
+				ips, err := net.DefaultResolver.LookupIPAddr(req.Context(), req.URL.Hostname())
+				if err != nil {
+					return nil, err
+				}
+				for _, ip := range ips {
+					if isPrivateIP(ip.IP) {
+						return nil, fmt.Errorf("connecting to %s is not allowed", ip.IP)
+					}
+				}
+			}
+			return proxyURL, nil
+		},
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			if config.AllowPrivateNetworks || (proxyURL != nil && address == proxyURL.Host) {
+				return dialer.DialContext(ctx, network, address)
+			}
+			return guardedDialer.DialContext(ctx, network, address)
+		},
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: fetchTimeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       90 * time.Second,
+	}, nil
+}
+
+// insecureTransport returns a copy of a transport that skips the
+// verification of the certificates of one host, for internal services with
+// self-signed certificates.
+func insecureTransport(transport *http.Transport, host string) *http.Transport {
+	insecure := transport.Clone()
+	roots := transport.TLSClientConfig.RootCAs
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+	insecure.TLSClientConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		// no server name is sent for IP addresses
+		if strings.EqualFold(state.ServerName, host) || (len(state.ServerName) == 0 && net.ParseIP(host) != nil) {
+			return nil
+		}
+		// other hosts, e.g. after a redirect, are verified as usual
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			DNSName:       state.ServerName,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+	// the transport is not reused
+	insecure.DisableKeepAlives = true
+	return insecure
+}
+
+// getHTTPTransport returns the transport of the active configuration.
+func (p *RSSFeedPlugin) getHTTPTransport() *http.Transport {
+	if transport := p.getConfiguration().transport; transport != nil {
+		return transport
+	}
+
+	// the settings have not been loaded, use the defaults
+	transport, _ := newHTTPTransport(&configuration{})
+	return transport
+}
+
+// fetch retrieves the content of a URL, failing for responses other than
+// 200 OK and for content larger than maxBytes. Subscription options such as
+// insecure and the credentials only apply to the host of the subscription
+// URL; subscription may be nil. URLs in errors are redacted, as they may
+// contain the credentials of the subscription.
+func (p *RSSFeedPlugin) fetch(url string, subscription *Subscription, timeout time.Duration, maxBytes int64) ([]byte, error) {
+	data, err := p.doFetch(url, subscription, timeout, maxBytes)
+	if err != nil {
+		return nil, errors.New(redactURLs(err.Error()))
+	}
+	return data, nil
+}
+
+func (p *RSSFeedPlugin) doFetch(url string, subscription *Subscription, timeout time.Duration, maxBytes int64) ([]byte, error) {
+	if err := p.checkFetchURL(url); err != nil {
+		return nil, err
+	}
+
+	transport, insecureHost := p.getHTTPTransport(), ""
+	if subscription != nil && subscription.Insecure {
+		insecureHost = subscriptionHost(subscription)
+		transport = insecureTransport(transport, insecureHost)
+	}
+
+	var auth *feedAuth
+	if subscription != nil {
+		var err error
+		if auth, err = p.getSubscriptionAuth(subscription); err != nil {
+			return nil, fmt.Errorf("unable to use the credentials of %s - %s", subscription.URL, err.Error())
+		}
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("stopped after too many redirects")
+			}
+			// other IP addresses couldn't be told apart from the insecure one
+			if net.ParseIP(insecureHost) != nil && net.ParseIP(req.URL.Hostname()) != nil && req.URL.Hostname() != insecureHost {
+				return errors.New("insecure subscriptions can't be redirected to other addresses")
+			}
+			// credentials are only sent to the host of the subscription
+			if auth != nil && !strings.EqualFold(req.URL.Hostname(), subscriptionHost(subscription)) {
+				auth.remove(req)
+			}
+			return p.checkFetchURL(req.URL.String())
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("Mattermost-RSSFeed-Plugin/%s", manifest.Version))
+	if auth != nil && strings.EqualFold(req.URL.Hostname(), subscriptionHost(subscription)) {
+		auth.apply(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if auth != nil {
+			return nil, errors.New(auth.redact(err.Error()))
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s fetching %s", resp.Status, url)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s - %s", url, err.Error())
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("content of %s exceeds %d bytes", url, maxBytes)
+	}
+
+	return data, nil
+}
+
+// subscriptionHost returns the host name of the URL of a subscription.
+func subscriptionHost(subscription *Subscription) string {
+	u, err := url.Parse(subscription.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
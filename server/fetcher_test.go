@@ -0,0 +1,210 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	for _, test := range []struct {
+		ip      string
+		private bool
+	}{
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"10.0.0.1", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"255.255.255.255", true},
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"::1", true},
+		{"::", true},
+		{"fc00::1", true},
+		{"fd12:3456:789a::1", true},
+		{"fe80::1", true},
+		{"ff02::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:8.8.8.8", false},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"2001:4860:4860::8888", false},
+	} {
+		t.Run(test.ip, func(t *testing.T) {
+			if private := isPrivateIP(net.ParseIP(test.ip)); private != test.private {
+				t.Errorf("got %v, want %v", private, test.private)
+			}
+		})
+	}
+}
+
+func TestMatchesDomain(t *testing.T) {
+	for _, test := range []struct {
+		host    string
+		domains []string
+		matches bool
+	}{
+		{"example.com", []string{"example.com"}, true},
+		{"EXAMPLE.com.", []string{"example.com"}, true},
+		{"feeds.example.com", []string{"example.com"}, true},
+		{"feeds.example.com", []string{"*.example.com"}, true},
+		{"badexample.com", []string{"example.com"}, false},
+		{"example.com.evil.net", []string{"example.com"}, false},
+		{"example.org", []string{"example.com", "example.org"}, true},
+		{"example.com", nil, false},
+	} {
+		t.Run(test.host, func(t *testing.T) {
+			if matches := matchesDomain(test.host, test.domains); matches != test.matches {
+				t.Errorf("matching %v: got %v, want %v", test.domains, matches, test.matches)
+			}
+		})
+	}
+}
+
+func TestCheckFetchURL(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		config  configuration
+		url     string
+		allowed bool
+	}{
+		{"public", configuration{}, "https://example.com/feed", true},
+		{"default schemes", configuration{}, "ftp://example.com/feed", false},
+		{"file", configuration{}, "file:///etc/passwd", false},
+		{"allowed scheme", configuration{AllowedSchemes: "https, ftp"}, "ftp://example.com/feed", true},
+		{"no host", configuration{}, "http:///feed", false},
+		{"loopback", configuration{}, "http://127.0.0.1/feed", false},
+		{"private", configuration{}, "http://192.168.0.10:8080/feed", false},
+		{"metadata", configuration{}, "http://169.254.169.254/latest/meta-data/", false},
+		{"ipv6 loopback", configuration{}, "http://[::1]/feed", false},
+		{"ipv6 unique local", configuration{}, "http://[fd00::1]/feed", false},
+		{"ipv4 mapped", configuration{}, "http://[::ffff:127.0.0.1]/feed", false},
+		{"private allowed", configuration{AllowPrivateNetworks: true}, "http://10.0.0.1/feed", true},
+		{"denied domain", configuration{DeniedDomains: "example.com"}, "https://feeds.example.com/feed", false},
+		{"other than denied domain", configuration{DeniedDomains: "example.com"}, "https://example.org/feed", true},
+		{"allowed domain", configuration{AllowedDomains: "*.example.com, example.org"}, "https://feeds.example.com/feed", true},
+		{"not allowed domain", configuration{AllowedDomains: "example.com"}, "https://example.net/feed", false},
+		{"denied within allowed", configuration{AllowedDomains: "example.com", DeniedDomains: "internal.example.com"}, "https://internal.example.com/feed", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, _ := newTestPlugin()
+			config := test.config
+			p.setConfiguration(&config)
+
+			err := p.checkFetchURL(test.url)
+			if (err == nil) != test.allowed {
+				t.Errorf("checking %s: got %v, want allowed %v", test.url, err, test.allowed)
+			}
+		})
+	}
+}
+
+// localhostURL replaces the address of a test server by localhost, which
+// passes checkFetchURL unlike 127.0.0.1.
+func localhostURL(server *httptest.Server) string {
+	return strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("feed"))
+	}))
+	defer server.Close()
+
+	p, _ := newTestPlugin()
+	transport, err := newHTTPTransport(&configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.setConfiguration(&configuration{transport: transport})
+
+	// the host name passes the URL check, but resolves to a loopback address
+	if _, err := p.fetch(localhostURL(server), nil, fetchTimeout, feedMaxBytes); err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("expected connecting to a loopback address to be refused, got %v", err)
+	}
+
+	allowed, err := newHTTPTransport(&configuration{AllowPrivateNetworks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.setConfiguration(&configuration{AllowPrivateNetworks: true, transport: allowed})
+	if data, err := p.fetch(server.URL, nil, fetchTimeout, feedMaxBytes); err != nil || string(data) != "feed" {
+		t.Errorf("expected private networks to be allowed, got %q, %v", data, err)
+	}
+}
+
+func TestFetchRefusesRedirectsToPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	p, _ := newTestPlugin()
+	// an unguarded transport, so that only the redirect is checked
+	p.setConfiguration(&configuration{transport: &http.Transport{}})
+
+	_, err := p.fetch(localhostURL(server), nil, fetchTimeout, feedMaxBytes)
+	if err == nil || !strings.Contains(err.Error(), "the address of http://169.254.169.254/latest/meta-data/ is not allowed") {
+		t.Errorf("expected the redirect to be refused, got %v", err)
+	}
+}
+
+func TestFetchRemovesCredentialsOnRedirectsToOtherHosts(t *testing.T) {
+	var received http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Write([]byte("feed"))
+	}))
+	defer other.Close()
+
+	var redirected http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same-host":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/target":
+			redirected = r.Header.Clone()
+			w.Write([]byte("feed"))
+		default:
+			// 127.0.0.1 is another host than localhost
+			http.Redirect(w, r, other.URL+"/feed", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	p, _ := newTestPlugin()
+	p.setConfiguration(&configuration{
+		AllowPrivateNetworks: true,
+		EncryptionKey:        "test key",
+		transport:            &http.Transport{},
+	})
+
+	subscription := &Subscription{ChannelID: "channel", URL: localhostURL(server) + "/feed"}
+	auth := &feedAuth{Token: "secret-token", Headers: map[string]string{"Private-Token": "secret-header"}}
+	if err := p.setSubscriptionAuth(subscription, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.fetch(subscription.URL, subscription, fetchTimeout, feedMaxBytes); err != nil {
+		t.Fatal(err)
+	}
+	if received.Get("Authorization") != "" || received.Get("Private-Token") != "" {
+		t.Errorf("credentials were sent to another host: %v", received)
+	}
+
+	if _, err := p.fetch(localhostURL(server)+"/same-host", subscription, fetchTimeout, feedMaxBytes); err != nil {
+		t.Fatal(err)
+	}
+	if redirected.Get("Authorization") != "Bearer secret-token" || redirected.Get("Private-Token") != "secret-header" {
+		t.Errorf("credentials were not sent after a redirect on the same host: %v", redirected)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Types of subscription filters.
+const (
+	filterInclude = "include"
+	filterExclude = "exclude"
+)
+
+// Filter is an include or exclude rule added with /feed filter. Patterns are
+// regular expressions matched case insensitively against the title, content,
+// categories and author of an item.
+type Filter struct {
+	Type    string
+	Pattern string
+}
+
+func newFilter(filterType string, pattern string) (*Filter, error) {
+	if filterType != filterInclude && filterType != filterExclude {
+		return nil, fmt.Errorf("invalid filter type %s, expected include or exclude", filterType)
+	}
+
+	filter := &Filter{Type: filterType, Pattern: pattern}
+	if _, err := filter.compile(); err != nil {
+		return nil, fmt.Errorf("invalid filter %s - %s", pattern, err.Error())
+	}
+
+	return filter, nil
+}
+
+func (f *Filter) compile() (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + f.Pattern)
+}
+
+// matchesFilters reports whether an item passes the filters of the
+// subscription: it has to match at least one include filter, if there are
+// any, and none of the exclude filters.
+func (s *Subscription) matchesFilters(item *feedItem) bool {
+	if len(s.Filters) == 0 {
+		return true
+	}
+
+	text := strings.Join([]string{item.Title, item.Content, strings.Join(item.Categories, "\n"), item.Author}, "\n")
+	hasInclude := false
+	included := false
+	for _, filter := range s.Filters {
+		re, err := filter.compile()
+		if err != nil {
+			continue
+		}
+
+		matched := re.MatchString(text)
+		switch filter.Type {
+		case filterExclude:
+			if matched {
+				return false
+			}
+		case filterInclude:
+			hasInclude = true
+			included = included || matched
+		}
+	}
+
+	return !hasInclude || included
+}
+
+func (s *Subscription) addFilter(filter *Filter) {
+	for _, existing := range s.Filters {
+		if *existing == *filter {
+			return
+		}
+	}
+	s.Filters = append(s.Filters, filter)
+}
+
+// removeFilter removes a filter and reports whether it existed.
+func (s *Subscription) removeFilter(filterType string, pattern string) bool {
+	for i, existing := range s.Filters {
+		if existing.Type == filterType && existing.Pattern == pattern {
+			s.Filters = append(s.Filters[:i], s.Filters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testGoldenFiles converts every testdata/<dir>/*.html file and compares the
+// result with the markdown in the .md file of the same name. Run the tests
+// with -update to write the current output to the golden files.
+func testGoldenFiles(t *testing.T, dir string, convert func(input string) string) {
+	files, err := filepath.Glob(filepath.Join("testdata", dir, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no test files in testdata/%s", dir)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".html")
+		t.Run(name, func(t *testing.T) {
+			input, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := convert(string(input))
+
+			golden := strings.TrimSuffix(file, ".html") + ".md"
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(actual), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != string(expected) {
+				t.Errorf("converting %s\ngot:\n%s\nwant:\n%s", file, actual, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const subscriptionTypeICS = "ics"
+
+// maxICSPeriods bounds the expansion of recurrence rules without an end.
+const maxICSPeriods = 100000
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// icsEvent is a VEVENT of an iCalendar feed. Daily and weekly recurrence
+// rules are expanded; events with other rules only appear with their first
+// occurrence.
+type icsEvent struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Status       string
+	Sequence     string
+	LastModified string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Recurrence   *icsRecurrence
+	// Exceptions are the starts of occurrences removed by EXDATE or replaced
+	// by an event with a RECURRENCE-ID, as Unix times.
+	Exceptions   map[int64]bool
+	RecurrenceID time.Time
+}
+
+// icsRecurrence is a daily or weekly RRULE, optionally limited by COUNT or
+// UNTIL and, for weekly rules, restricted to the days of BYDAY.
+type icsRecurrence struct {
+	Frequency string
+	Interval  int
+	Count     int
+	Until     time.Time
+	Days      []time.Weekday
+}
+
+// version identifies the revision of an event, so changed events get a new
+// item key.
+func (e *icsEvent) version() string {
+	return strings.Join([]string{e.Sequence, e.LastModified, e.Start.UTC().Format(time.RFC3339), e.Summary, e.Status}, "|")
+}
+
+// icsProperty is a content line of an iCalendar file.
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// parseICS parses the calendar name and the events of an iCalendar file.
+func parseICS(data string) (string, []*icsEvent, error) {
+	lines := unfoldICSLines(data)
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return "", nil, fmt.Errorf("not an iCalendar file")
+	}
+
+	name := ""
+	events := []*icsEvent{}
+	var event *icsEvent
+	nested := 0
+	for _, line := range lines {
+		property := parseICSProperty(line)
+		switch {
+		case property.Name == "BEGIN" && strings.EqualFold(property.Value, "VEVENT"):
+			event = &icsEvent{}
+		case property.Name == "BEGIN" && event != nil:
+			// skip the properties of alarms and other components within the event
+			nested++
+		case property.Name == "END" && event != nil && nested > 0:
+			nested--
+		case property.Name == "END" && strings.EqualFold(property.Value, "VEVENT"):
+			if event != nil && len(event.UID) > 0 && !event.Start.IsZero() {
+				events = append(events, event)
+			}
+			event = nil
+		case event == nil:
+			if property.Name == "X-WR-CALNAME" {
+				name = unescapeICSText(property.Value)
+			}
+		case nested > 0:
+		default:
+			event.setProperty(property)
+		}
+	}
+
+	// occurrences replaced by an event of their own are not expanded
+	series := map[string]*icsEvent{}
+	for _, event := range events {
+		if event.Recurrence != nil && event.RecurrenceID.IsZero() {
+			series[event.UID] = event
+		}
+	}
+	for _, event := range events {
+		if recurring, ok := series[event.UID]; ok && !event.RecurrenceID.IsZero() {
+			recurring.addException(event.RecurrenceID)
+		}
+	}
+
+	return name, events, nil
+}
+
+func (e *icsEvent) setProperty(property icsProperty) {
+	switch property.Name {
+	case "UID":
+		e.UID = property.Value
+	case "SUMMARY":
+		e.Summary = unescapeICSText(property.Value)
+	case "DESCRIPTION":
+		e.Description = unescapeICSText(property.Value)
+	case "LOCATION":
+		e.Location = unescapeICSText(property.Value)
+	case "URL":
+		e.URL = property.Value
+	case "STATUS":
+		e.Status = strings.ToUpper(property.Value)
+	case "SEQUENCE":
+		e.Sequence = property.Value
+	case "LAST-MODIFIED":
+		e.LastModified = property.Value
+	case "DTSTART":
+		e.Start, e.AllDay = parseICSTime(property)
+	case "DTEND":
+		e.End, _ = parseICSTime(property)
+	case "RRULE":
+		e.Recurrence = parseICSRecurrence(property.Value)
+	case "EXDATE":
+		for _, value := range strings.Split(property.Value, ",") {
+			if t, _ := parseICSTime(icsProperty{Params: property.Params, Value: value}); !t.IsZero() {
+				e.addException(t)
+			}
+		}
+	case "RECURRENCE-ID":
+		e.RecurrenceID, _ = parseICSTime(property)
+	}
+}
+
+func (e *icsEvent) addException(start time.Time) {
+	if e.Exceptions == nil {
+		e.Exceptions = map[int64]bool{}
+	}
+	e.Exceptions[start.Unix()] = true
+}
+
+// parseICSRecurrence parses a recurrence rule, or returns nil if it is not a
+// daily or weekly rule this plugin can expand.
+func parseICSRecurrence(value string) *icsRecurrence {
+	rule := &icsRecurrence{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		name, value := strings.ToUpper(pair[0]), strings.ToUpper(pair[1])
+		switch name {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" {
+				return nil
+			}
+			rule.Frequency = value
+		case "INTERVAL", "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil
+			}
+			if name == "INTERVAL" {
+				rule.Interval = n
+			} else {
+				rule.Count = n
+			}
+		case "UNTIL":
+			until, allDay := parseICSTime(icsProperty{Params: map[string]string{}, Value: value})
+			if until.IsZero() {
+				return nil
+			}
+			if allDay {
+				// the last day is included
+				until = until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := icsWeekdays[day]
+				if !ok {
+					return nil
+				}
+				rule.Days = append(rule.Days, weekday)
+			}
+		case "WKST":
+		default:
+			return nil
+		}
+	}
+
+	if len(rule.Frequency) == 0 || (rule.Frequency == "DAILY" && len(rule.Days) > 0) {
+		return nil
+	}
+	return rule
+}
+
+// describe names the recurrence, e.g. "every 2 weeks on Mon, Thu".
+func (r *icsRecurrence) describe() string {
+	unit := "day"
+	if r.Frequency == "WEEKLY" {
+		unit = "week"
+	}
+
+	text := "every " + unit
+	if r.Interval > 1 {
+		text = fmt.Sprintf("every %d %ss", r.Interval, unit)
+	}
+
+	if len(r.Days) > 0 {
+		days := []string{}
+		for _, day := range r.Days {
+			days = append(days, day.String()[:3])
+		}
+		text = text + " on " + strings.Join(days, ", ")
+	}
+	return text
+}
+
+// occurrences calls fn with the start of every occurrence of a recurring
+// event in order, until fn returns false or the rule ends. Weeks start on
+// Monday.
+func (e *icsEvent) occurrences(fn func(start time.Time) bool) {
+	rule := e.Recurrence
+	count := 0
+	for period := 0; period < maxICSPeriods; period += rule.Interval {
+		starts := []time.Time{}
+		if rule.Frequency == "DAILY" {
+			starts = append(starts, e.Start.AddDate(0, 0, period))
+		} else {
+			days := rule.Days
+			if len(days) == 0 {
+				days = []time.Weekday{e.Start.Weekday()}
+			}
+			monday := e.Start.AddDate(0, 0, 7*period-(int(e.Start.Weekday())+6)%7)
+			for _, day := range days {
+				if start := monday.AddDate(0, 0, (int(day)+6)%7); !start.Before(e.Start) {
+					starts = append(starts, start)
+				}
+			}
+			sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+		}
+
+		for _, start := range starts {
+			if !rule.Until.IsZero() && start.After(rule.Until) {
+				return
+			}
+			count++
+			if rule.Count > 0 && count > rule.Count {
+				return
+			}
+			if e.Exceptions[start.Unix()] {
+				continue
+			}
+			if !fn(start) {
+				return
+			}
+		}
+	}
+}
+
+// occurrence returns a copy of a recurring event starting at the given time.
+func (e *icsEvent) occurrence(start time.Time) *icsEvent {
+	occurrence := *e
+	occurrence.Start = start
+	if !e.End.IsZero() {
+		if e.AllDay {
+			occurrence.End = start.AddDate(0, 0, int(e.End.Sub(e.Start).Hours()/24+0.5))
+		} else {
+			occurrence.End = start.Add(e.End.Sub(e.Start))
+		}
+	}
+	return &occurrence
+}
+
+// nextOccurrence returns the first occurrence of an event that has not ended
+// by now, or nil if there is none. An event that does not recur is its only
+// occurrence.
+func (e *icsEvent) nextOccurrence(now time.Time) *icsEvent {
+	if e.Recurrence == nil {
+		if eventEnd(e).Before(now) {
+			return nil
+		}
+		return e
+	}
+
+	var next *icsEvent
+	e.occurrences(func(start time.Time) bool {
+		occurrence := e.occurrence(start)
+		if eventEnd(occurrence).Before(now) {
+			return true
+		}
+		next = occurrence
+		return false
+	})
+	return next
+}
+
+// upcomingOccurrences returns the occurrences of a recurring event starting
+// between now and until, or the event itself if it does not recur.
+func (e *icsEvent) upcomingOccurrences(now time.Time, until time.Time) []*icsEvent {
+	if e.Recurrence == nil {
+		return []*icsEvent{e}
+	}
+
+	upcoming := []*icsEvent{}
+	e.occurrences(func(start time.Time) bool {
+		if start.After(until) {
+			return false
+		}
+		if !start.Before(now) {
+			upcoming = append(upcoming, e.occurrence(start))
+		}
+		return true
+	})
+	return upcoming
+}
+
+// unfoldICSLines joins lines continued with a leading space or tab.
+func unfoldICSLines(data string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if len(strings.TrimSpace(line)) > 0 {
+			lines = append(lines, strings.TrimRight(line, "\r"))
+		}
+	}
+	return lines
+}
+
+func parseICSProperty(line string) icsProperty {
+	property := icsProperty{Params: map[string]string{}}
+
+	// the value starts at the first colon outside of quoted parameter values
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		property.Name = strings.ToUpper(line)
+		return property
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	property.Name = strings.ToUpper(parts[0])
+	property.Value = line[colon+1:]
+	for _, param := range parts[1:] {
+		if i := strings.Index(param, "="); i > 0 {
+			property.Params[strings.ToUpper(param[:i])] = strings.Trim(param[i+1:], "\"")
+		}
+	}
+	return property
+}
+
+// parseICSTime parses a DATE or DATE-TIME value, which is either in UTC, in
+// the time zone of its TZID parameter, or floating in the server's time zone.
+func parseICSTime(property icsProperty) (time.Time, bool) {
+	location := time.Local
+	if tzid, ok := property.Params["TZID"]; ok {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			location = tz
+		}
+	}
+
+	value := strings.TrimSpace(property.Value)
+	if property.Params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, location)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, true
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, false
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, false
+}
+
+func unescapeICSText(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+func (p *RSSFeedPlugin) processICSSubscription(subscription *Subscription) error {
+	data, err := p.fetch(subscription.URL, subscription, fetchTimeout, feedMaxBytes)
+	if err != nil {
+		return err
+	}
+
+	name, events, err := parseICS(string(data))
+	if err != nil {
+		return err
+	}
+
+	if len(name) == 0 {
+		name = redactURL(subscription.URL)
+		if u, err := url.Parse(subscription.URL); err == nil && len(u.Host) > 0 {
+			name = u.Host
+		}
+	}
+
+	now := time.Now()
+	previousUIDs := map[string]bool{}
+	for _, key := range subscription.ItemKeys {
+		previousUIDs[strings.SplitN(key, "|", 2)[0]] = true
+	}
+
+	items := []*feedItem{}
+	for _, event := range events {
+		// events that are over are neither announced nor remembered, and
+		// recurring events are announced once with their next occurrence
+		next := event.nextOccurrence(now)
+		if next == nil {
+			continue
+		}
+
+		item := &feedItem{
+			Key:       event.UID + "|" + event.version(),
+			FeedTitle: name,
+			Title:     event.Summary,
+			Link:      event.URL,
+			Content:   event.Description,
+		}
+		item.Message = p.formatICSEvent(subscription, item, next, previousUIDs[event.UID])
+		items = append(items, item)
+	}
+
+	p.processSyntheticItems(subscription, items)
+
+	if p.processReminders(subscription, name, events, now) {
+		p.updateSubscriptionState(subscription)
+	}
+	return nil
+}
+
+// eventEnd returns the end of an event, defaulting to its start or, for all
+// day events, to the end of its day.
+func eventEnd(event *icsEvent) time.Time {
+	if !event.End.IsZero() {
+		return event.End
+	}
+	if event.AllDay {
+		return event.Start.AddDate(0, 0, 1)
+	}
+	return event.Start
+}
+
+func (p *RSSFeedPlugin) formatICSEvent(subscription *Subscription, item *feedItem, event *icsEvent, changed bool) string {
+	config := p.getConfiguration()
+	post := ""
+
+	if config.FormatTitle {
+		post = post + "##### "
+	}
+	post = post + item.FeedTitle + "\n"
+
+	title := event.Summary
+	if event.Status == "CANCELLED" {
+		title = "Cancelled: " + title
+	} else if changed {
+		title = "Updated: " + title
+	}
+	if config.FormatTitle {
+		post = post + "###### "
+	}
+	post = post + title + "\n"
+
+	post = post + "**When:** " + formatEventTime(event, subscription.location()) + "\n"
+	if event.Recurrence != nil {
+		post = post + "**Repeats:** " + event.Recurrence.describe() + "\n"
+	}
+	if len(event.Location) > 0 {
+		post = post + "**Where:** " + event.Location + "\n"
+	}
+	if len(event.URL) > 0 {
+		post = post + event.URL + "\n"
+	}
+	if len(event.Description) > 0 {
+		post = post + event.Description + "\n"
+	}
+
+	return post
+}
+
+func formatEventTime(event *icsEvent, location *time.Location) string {
+	if event.AllDay {
+		start := event.Start.Format("Mon, Jan 2 2006")
+		if !event.End.IsZero() && event.End.Sub(event.Start) > 24*time.Hour {
+			return start + " - " + event.End.AddDate(0, 0, -1).Format("Mon, Jan 2 2006")
+		}
+		return start
+	}
+
+	start := event.Start.In(location)
+	text := start.Format("Mon, Jan 2 2006 15:04")
+	if !event.End.IsZero() {
+		end := event.End.In(location)
+		if end.YearDay() == start.YearDay() && end.Year() == start.Year() {
+			text = text + " - " + end.Format("15:04")
+		} else {
+			text = text + " - " + end.Format("Mon, Jan 2 2006 15:04")
+		}
+	}
+	return text + " " + start.Format("MST")
+}
+
+// processReminders posts a reminder for every event occurrence starting
+// within the reminder time of the subscription, and reports whether the
+// subscription's reminders changed. As the feed is only checked once per
+// heartbeat, a reminder is posted by the last check before its time rather
+// than by the first one after it.
+func (p *RSSFeedPlugin) processReminders(subscription *Subscription, calendarName string, events []*icsEvent, now time.Time) bool {
+	if subscription.Remind <= 0 && len(subscription.Reminded) == 0 {
+		return false
+	}
+
+	reminded := map[string]bool{}
+	for _, key := range subscription.Reminded {
+		reminded[key] = true
+	}
+
+	heartbeatTime, _ := p.getHeartbeatTime()
+	remind := time.Duration(subscription.Remind) * time.Minute
+	lookahead := remind + time.Duration(heartbeatTime)*time.Minute
+
+	occurrences := []*icsEvent{}
+	for _, event := range events {
+		occurrences = append(occurrences, event.upcomingOccurrences(now, now.Add(lookahead))...)
+	}
+
+	changed := false
+	current := []string{}
+	for _, event := range occurrences {
+		if event.Start.Before(now) || event.Status == "CANCELLED" {
+			continue
+		}
+
+		key := event.UID + "|" + event.Start.UTC().Format(time.RFC3339)
+		if reminded[key] {
+			current = append(current, key)
+			continue
+		}
+
+		if subscription.Remind <= 0 || event.Start.Sub(now) > lookahead {
+			continue
+		}
+
+		minutes := int(event.Start.Sub(now).Minutes() + 0.5)
+		message := fmt.Sprintf(":alarm_clock: **%s** starts in %d minutes (%s)", event.Summary, minutes, formatEventTime(event, subscription.location()))
+		if len(event.Location) > 0 {
+			message = message + "\n**Where:** " + event.Location
+		}
+		if _, err := p.createItemPost(subscription, calendarName, message+"\n", event.URL); err == nil {
+			current = append(current, key)
+			changed = true
+		}
+	}
+
+	if len(current) != len(subscription.Reminded) {
+		changed = true
+	}
+	subscription.Reminded = current
+	return changed
+}
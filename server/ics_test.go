@@ -0,0 +1,375 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s is not available: %v", name, err)
+	}
+	return location
+}
+
+func TestUnfoldICSLines(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\nDESCRIPTION:a long\r\n  line\r\n\t continued\r\n\r\nSUMMARY:next\nEND:VCALENDAR\r\n"
+	expected := []string{"BEGIN:VCALENDAR", "DESCRIPTION:a long line continued", "SUMMARY:next", "END:VCALENDAR"}
+	if actual := unfoldICSLines(data); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %q, want %q", actual, expected)
+	}
+}
+
+func TestParseICSTime(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	for _, test := range []struct {
+		line     string
+		expected time.Time
+		allDay   bool
+	}{
+		{"DTSTART:20210304T050607Z", time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC), false},
+		{"DTSTART;TZID=Europe/Berlin:20210304T090000", time.Date(2021, time.March, 4, 9, 0, 0, 0, berlin), false},
+		{`DTSTART;TZID="Europe/Berlin":20210704T090000`, time.Date(2021, time.July, 4, 9, 0, 0, 0, berlin), false},
+		{"DTSTART;TZID=Nowhere/Unknown:20210304T090000", time.Date(2021, time.March, 4, 9, 0, 0, 0, time.Local), false},
+		{"DTSTART:20210304T090000", time.Date(2021, time.March, 4, 9, 0, 0, 0, time.Local), false},
+		{"DTSTART;VALUE=DATE:20210304", time.Date(2021, time.March, 4, 0, 0, 0, 0, time.Local), true},
+		{"DTSTART:20210304", time.Date(2021, time.March, 4, 0, 0, 0, 0, time.Local), true},
+		{"DTSTART;TZID=Europe/Berlin;VALUE=DATE:20210304", time.Date(2021, time.March, 4, 0, 0, 0, 0, berlin), true},
+		{"DTSTART:tomorrow", time.Time{}, false},
+		{"DTSTART;VALUE=DATE:2021-03-04", time.Time{}, false},
+	} {
+		actual, allDay := parseICSTime(parseICSProperty(test.line))
+		if !actual.Equal(test.expected) || allDay != test.allDay {
+			t.Errorf("parsing %q: got %v (all day %v), want %v (all day %v)", test.line, actual, allDay, test.expected, test.allDay)
+		}
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"X-WR-CALNAME:Team\\, Calendar",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"SUMMARY:Standup",
+		"DESCRIPTION:Daily\\nsync",
+		"DTSTART;TZID=Europe/Berlin:20210301T093000",
+		"DTEND;TZID=Europe/Berlin:20210301T094500",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR",
+		"EXDATE;TZID=Europe/Berlin:20210303T093000,20210305T093000",
+		"BEGIN:VALARM",
+		"DESCRIPTION:Reminder",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20210308T093000",
+		"SUMMARY:Standup (moved)",
+		"DTSTART;TZID=Europe/Berlin:20210308T110000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:holiday",
+		"SUMMARY:Holiday",
+		"LOCATION:Every",
+		" where",
+		"DTSTART;VALUE=DATE:20210305",
+		"STATUS:cancelled",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Without an uid",
+		"DTSTART:20210305T100000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:without-a-start",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	name, events, err := parseICS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Team, Calendar" {
+		t.Errorf("got calendar name %q", name)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+
+	standup := events[0]
+	if standup.Summary != "Standup" || standup.Description != "Daily\nsync" {
+		t.Errorf("unexpected standup: %+v", standup)
+	}
+	if !standup.Start.Equal(time.Date(2021, time.March, 1, 9, 30, 0, 0, berlin)) || standup.End.Sub(standup.Start) != 15*time.Minute {
+		t.Errorf("unexpected standup time: %v - %v", standup.Start, standup.End)
+	}
+	if standup.Recurrence == nil || standup.Recurrence.describe() != "every week on Mon, Wed, Fri" {
+		t.Errorf("unexpected standup recurrence: %+v", standup.Recurrence)
+	}
+	exceptions := map[int64]bool{
+		time.Date(2021, time.March, 3, 9, 30, 0, 0, berlin).Unix(): true,
+		time.Date(2021, time.March, 5, 9, 30, 0, 0, berlin).Unix(): true,
+		time.Date(2021, time.March, 8, 9, 30, 0, 0, berlin).Unix(): true,
+	}
+	if !reflect.DeepEqual(standup.Exceptions, exceptions) {
+		t.Errorf("got exceptions %v, want %v", standup.Exceptions, exceptions)
+	}
+
+	if moved := events[1]; moved.UID != "standup" || moved.RecurrenceID.IsZero() || moved.Recurrence != nil {
+		t.Errorf("unexpected moved occurrence: %+v", moved)
+	}
+
+	holiday := events[2]
+	if !holiday.AllDay || holiday.Status != "CANCELLED" || holiday.Location != "Everywhere" {
+		t.Errorf("unexpected holiday: %+v", holiday)
+	}
+
+	if _, _, err := parseICS("<html></html>"); err == nil {
+		t.Error("expected a file that is not a calendar to fail")
+	}
+}
+
+func TestParseICSRecurrence(t *testing.T) {
+	for _, test := range []struct {
+		rule     string
+		expected *icsRecurrence
+	}{
+		{"FREQ=DAILY", &icsRecurrence{Frequency: "DAILY", Interval: 1}},
+		{"freq=daily;interval=2;count=5", &icsRecurrence{Frequency: "DAILY", Interval: 2, Count: 5}},
+		{"FREQ=WEEKLY;BYDAY=TU,TH;WKST=MO", &icsRecurrence{Frequency: "WEEKLY", Interval: 1, Days: []time.Weekday{time.Tuesday, time.Thursday}}},
+		{"FREQ=WEEKLY;UNTIL=20210331T235959Z", &icsRecurrence{Frequency: "WEEKLY", Interval: 1, Until: time.Date(2021, time.March, 31, 23, 59, 59, 0, time.UTC)}},
+		{"FREQ=DAILY;UNTIL=20210331", &icsRecurrence{Frequency: "DAILY", Interval: 1, Until: time.Date(2021, time.March, 31, 23, 59, 59, 0, time.Local)}},
+		{"FREQ=MONTHLY", nil},
+		{"FREQ=WEEKLY;BYDAY=1MO", nil},
+		{"FREQ=DAILY;BYDAY=MO", nil},
+		{"FREQ=DAILY;BYHOUR=9", nil},
+		{"FREQ=DAILY;COUNT=0", nil},
+		{"FREQ=DAILY;INTERVAL=x", nil},
+		{"FREQ=DAILY;UNTIL=someday", nil},
+		{"COUNT=3", nil},
+	} {
+		actual := parseICSRecurrence(test.rule)
+		if test.expected == nil || actual == nil {
+			if actual != test.expected {
+				t.Errorf("parsing %q: got %+v, want %+v", test.rule, actual, test.expected)
+			}
+			continue
+		}
+		if !actual.Until.Equal(test.expected.Until) {
+			t.Errorf("parsing %q: got until %v, want %v", test.rule, actual.Until, test.expected.Until)
+		}
+		actual.Until, test.expected.Until = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("parsing %q: got %+v, want %+v", test.rule, actual, test.expected)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2021, month, day, hour, 30, 0, 0, berlin)
+	}
+
+	for _, test := range []struct {
+		name       string
+		start      time.Time
+		rule       string
+		exceptions []time.Time
+		expected   []time.Time
+	}{{
+		name:     "daily with count",
+		start:    at(time.March, 1, 9),
+		rule:     "FREQ=DAILY;COUNT=3",
+		expected: []time.Time{at(time.March, 1, 9), at(time.March, 2, 9), at(time.March, 3, 9)},
+	}, {
+		name:     "daily with an interval and until",
+		start:    at(time.March, 1, 9),
+		rule:     "FREQ=DAILY;INTERVAL=2;UNTIL=20210305T083000Z",
+		expected: []time.Time{at(time.March, 1, 9), at(time.March, 3, 9), at(time.March, 5, 9)},
+	}, {
+		name:     "daily until a date includes that day",
+		start:    at(time.March, 1, 9),
+		rule:     "FREQ=DAILY;UNTIL=20210302",
+		expected: []time.Time{at(time.March, 1, 9), at(time.March, 2, 9)},
+	}, {
+		name:     "daily across a daylight saving time change",
+		start:    at(time.March, 27, 9),
+		rule:     "FREQ=DAILY;COUNT=3",
+		expected: []time.Time{at(time.March, 27, 9), at(time.March, 28, 9), at(time.March, 29, 9)},
+	}, {
+		name:     "weekly on the day of the start",
+		start:    at(time.March, 3, 9),
+		rule:     "FREQ=WEEKLY;COUNT=3",
+		expected: []time.Time{at(time.March, 3, 9), at(time.March, 10, 9), at(time.March, 17, 9)},
+	}, {
+		name:     "weekly by day starting mid week",
+		start:    at(time.March, 3, 9),
+		rule:     "FREQ=WEEKLY;BYDAY=FR,MO,WE;COUNT=5",
+		expected: []time.Time{at(time.March, 3, 9), at(time.March, 5, 9), at(time.March, 8, 9), at(time.March, 10, 9), at(time.March, 12, 9)},
+	}, {
+		name:     "every other week across a week boundary",
+		start:    at(time.March, 4, 9),
+		rule:     "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH,SU;UNTIL=20210321T235959Z",
+		expected: []time.Time{at(time.March, 4, 9), at(time.March, 7, 9), at(time.March, 16, 9), at(time.March, 18, 9), at(time.March, 21, 9)},
+	}, {
+		name:       "exceptions count towards the count",
+		start:      at(time.March, 1, 9),
+		rule:       "FREQ=DAILY;COUNT=3",
+		exceptions: []time.Time{at(time.March, 2, 9)},
+		expected:   []time.Time{at(time.March, 1, 9), at(time.March, 3, 9)},
+	}} {
+		event := &icsEvent{Start: test.start, Recurrence: parseICSRecurrence(test.rule)}
+		for _, exception := range test.exceptions {
+			event.addException(exception)
+		}
+
+		actual := []time.Time{}
+		event.occurrences(func(start time.Time) bool {
+			actual = append(actual, start)
+			return len(actual) < 10
+		})
+
+		if len(actual) != len(test.expected) {
+			t.Errorf("%s: got %v, want %v", test.name, actual, test.expected)
+			continue
+		}
+		for i := range actual {
+			if !actual[i].Equal(test.expected[i]) {
+				t.Errorf("%s: got %v, want %v", test.name, actual, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 9, 0, 0, 0, time.UTC)
+	event := &icsEvent{Start: start, End: start.Add(time.Hour)}
+
+	if next := event.nextOccurrence(start.Add(30 * time.Minute)); next != event {
+		t.Errorf("expected an ongoing event to be its next occurrence, got %+v", next)
+	}
+	if next := event.nextOccurrence(start.Add(2 * time.Hour)); next != nil {
+		t.Errorf("expected an event that is over to have no next occurrence, got %+v", next)
+	}
+
+	event.Recurrence = parseICSRecurrence("FREQ=DAILY;COUNT=3")
+	if next := event.nextOccurrence(start.Add(26 * time.Hour)); next == nil || !next.Start.Equal(start.AddDate(0, 0, 2)) || !next.End.Equal(start.AddDate(0, 0, 2).Add(time.Hour)) {
+		t.Errorf("unexpected next occurrence %+v", next)
+	}
+	if next := event.nextOccurrence(start.AddDate(0, 0, 3)); next != nil {
+		t.Errorf("expected a finished series to have no next occurrence, got %+v", next)
+	}
+
+	allDay := &icsEvent{Start: start.Truncate(24 * time.Hour), AllDay: true, Recurrence: parseICSRecurrence("FREQ=WEEKLY")}
+	if next := allDay.nextOccurrence(start.Add(12 * time.Hour)); next == nil || !next.Start.Equal(allDay.Start) {
+		t.Errorf("expected an all day event to last until the end of its day, got %+v", next)
+	}
+}
+
+func TestUpcomingOccurrences(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 9, 0, 0, 0, time.UTC)
+	event := &icsEvent{Start: start, Recurrence: parseICSRecurrence("FREQ=DAILY")}
+
+	upcoming := event.upcomingOccurrences(start.Add(time.Hour), start.AddDate(0, 0, 3))
+	if len(upcoming) != 3 || !upcoming[0].Start.Equal(start.AddDate(0, 0, 1)) || !upcoming[2].Start.Equal(start.AddDate(0, 0, 3)) {
+		t.Errorf("unexpected upcoming occurrences %+v", upcoming)
+	}
+
+	single := &icsEvent{Start: start}
+	if upcoming := single.upcomingOccurrences(start.Add(time.Hour), start.AddDate(0, 0, 3)); len(upcoming) != 1 || upcoming[0] != single {
+		t.Errorf("expected an event that does not recur to be returned as is, got %+v", upcoming)
+	}
+}
+
+func TestProcessReminders(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 9, 0, 0, 0, time.UTC)
+	event := func(uid string, minutes int) *icsEvent {
+		return &icsEvent{UID: uid, Summary: uid, Start: now.Add(time.Duration(minutes) * time.Minute)}
+	}
+	key := func(e *icsEvent) string {
+		return e.UID + "|" + e.Start.UTC().Format(time.RFC3339)
+	}
+
+	p, api := newTestPlugin()
+	subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/calendar.ics", Remind: 30, Timezone: "UTC"}
+
+	// with the default heartbeat of 15 minutes, an event starting in 44
+	// minutes is 29 minutes away at the next check, so its reminder is
+	// posted now
+	lastCheck := event("last-check", 44)
+	later := event("later", 46)
+	soon := event("soon", 10)
+	cancelled := event("cancelled", 20)
+	cancelled.Status = "CANCELLED"
+	started := event("started", -5)
+	events := []*icsEvent{lastCheck, later, soon, cancelled, started}
+
+	if !p.processReminders(subscription, "Calendar", events, now) {
+		t.Error("expected the reminders to change")
+	}
+
+	posts := api.channelPosts("channel")
+	if len(posts) != 2 ||
+		!strings.Contains(posts[0].Message, ":alarm_clock: **last-check** starts in 44 minutes (Mon, Mar 1 2021 09:44 UTC)") ||
+		!strings.Contains(posts[1].Message, "**soon** starts in 10 minutes") {
+		t.Fatalf("unexpected reminders %v", posts)
+	}
+	if expected := []string{key(lastCheck), key(soon)}; !reflect.DeepEqual(subscription.Reminded, expected) {
+		t.Errorf("got reminded %v, want %v", subscription.Reminded, expected)
+	}
+
+	// at the next check the reminded events are not posted again, the event
+	// that was too far away is now within the lookahead
+	now = now.Add(15 * time.Minute)
+	if !p.processReminders(subscription, "Calendar", events, now) {
+		t.Error("expected the reminders to change")
+	}
+	posts = api.channelPosts("channel")
+	if len(posts) != 3 || !strings.Contains(posts[2].Message, "**later** starts in 31 minutes") {
+		t.Fatalf("unexpected reminders %v", posts)
+	}
+
+	// reminders of events that have started are forgotten
+	now = now.Add(time.Hour)
+	if !p.processReminders(subscription, "Calendar", events, now) {
+		t.Error("expected the reminders to change")
+	}
+	if len(subscription.Reminded) != 0 || len(api.channelPosts("channel")) != 3 {
+		t.Errorf("unexpected reminders %v after all events started", subscription.Reminded)
+	}
+	if p.processReminders(subscription, "Calendar", events, now) {
+		t.Error("expected the reminders not to change")
+	}
+}
+
+func TestProcessRemindersHeartbeat(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 9, 0, 0, 0, time.UTC)
+	events := []*icsEvent{
+		{UID: "a", Summary: "A", Start: now.Add(34 * time.Minute)},
+		{UID: "b", Summary: "B", Start: now.Add(36 * time.Minute)},
+	}
+
+	p, api := newTestPlugin()
+	p.setConfiguration(&configuration{Heartbeat: "5"})
+	subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/calendar.ics", Remind: 30}
+
+	p.processReminders(subscription, "Calendar", events, now)
+	if posts := api.channelPosts("channel"); len(posts) != 1 || !strings.Contains(posts[0].Message, "**A** starts in 34 minutes") {
+		t.Errorf("expected only the event within the reminder time and heartbeat to be reminded, got %v", posts)
+	}
+
+	subscription = &Subscription{ChannelID: "other", URL: "https://example.com/calendar.ics"}
+	if p.processReminders(subscription, "Calendar", events, now) || len(api.channelPosts("other")) != 0 {
+		t.Error("expected no reminders without a reminder time")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (p *RSSFeedPlugin) processJSONSubscription(subscription *Subscription) error {
+	data, err := p.fetch(subscription.URL, subscription, fetchTimeout, feedMaxBytes)
+	if err != nil {
+		return err
+	}
+
+	items, err := mapJSONItems(data, subscription.URL, subscription.Mapping)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		item := item
+		item.format = func() string { return p.formatFeedItem(subscription, item) }
+	}
+
+	p.processSyntheticItems(subscription, items)
+	return nil
+}
+
+// mapJSONItems derives feed items from a JSON document. The item path of the
+// mapping selects the items, defaulting to the document itself, and an array
+// selected by it is expanded into its elements. The other paths are
+// evaluated against each item.
+func mapJSONItems(data []byte, sourceURL string, mapping *ItemMapping) ([]*feedItem, error) {
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	if mapping == nil {
+		mapping = &ItemMapping{}
+	}
+
+	itemPath := mapping.Item
+	if len(itemPath) == 0 {
+		itemPath = "$"
+	}
+	steps, err := parseJSONPath(itemPath)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := evalJSONPath(document, steps)
+	if len(elements) == 1 {
+		if array, ok := elements[0].([]interface{}); ok {
+			elements = array
+		}
+	}
+
+	feedTitle := sourceURL
+	if u, err := url.Parse(sourceURL); err == nil && len(u.Host) > 0 {
+		feedTitle = u.Host
+	}
+
+	items := []*feedItem{}
+	for _, element := range elements {
+		item := &feedItem{
+			FeedTitle: feedTitle,
+			Title:     jsonPathString(element, mapping.Title),
+			Link:      resolveURL(sourceURL, jsonPathString(element, mapping.Link)),
+			Content:   jsonPathString(element, mapping.Body),
+			Published: parseJSONDate(jsonPathString(element, mapping.Date)),
+		}
+
+		item.Key = jsonPathString(element, mapping.ID)
+		if len(item.Key) == 0 {
+			item.Key = item.Link
+		}
+		if len(item.Key) == 0 {
+			item.Key = item.Title
+		}
+		if len(item.Key) == 0 {
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseJSONDate parses a feed date or a unix timestamp in seconds or
+// milliseconds.
+func parseJSONDate(value string) time.Time {
+	if timestamp, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+		if timestamp > 1e12 {
+			return time.Unix(0, int64(timestamp)*int64(time.Millisecond))
+		}
+		return time.Unix(int64(timestamp), 0)
+	}
+	return parseFeedDate(value)
+}
+
+// validateJSONMapping makes sure all paths of a mapping can be parsed.
+func validateJSONMapping(mapping *ItemMapping) error {
+	if mapping == nil {
+		return nil
+	}
+
+	for _, path := range mapping.fields() {
+		if len(path[1]) == 0 {
+			continue
+		}
+		if _, err := parseJSONPath(path[1]); err != nil {
+			return fmt.Errorf("invalid %s path %s - %s", path[0], path[1], err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type expectedItem struct {
+	key, title, link, content string
+}
+
+func checkItems(t *testing.T, name string, items []*feedItem, expected []expectedItem) {
+	t.Helper()
+	if len(items) != len(expected) {
+		t.Errorf("%s: got %d items, want %d", name, len(items), len(expected))
+		return
+	}
+	for i, item := range items {
+		actual := expectedItem{item.Key, item.Title, item.Link, item.Content}
+		if actual != expected[i] {
+			t.Errorf("%s: item %d is %+v, want %+v", name, i, actual, expected[i])
+		}
+	}
+}
+
+func TestMapJSONItems(t *testing.T) {
+	const document = `{
+		"data": {
+			"releases": [
+				{"id": 7, "name": "v1.0", "url": "/releases/1.0", "notes": "First"},
+				{"name": "v1.1", "url": "https://example.org/releases/1.1"},
+				{"name": "v1.2"},
+				{"notes": "neither a key, a link nor a title"}
+			],
+			"latest": {"id": 9, "name": "v2.0"}
+		}
+	}`
+
+	for _, test := range []struct {
+		name     string
+		data     string
+		mapping  *ItemMapping
+		expected []expectedItem
+	}{{
+		name:    "array of items",
+		data:    document,
+		mapping: &ItemMapping{Item: "$.data.releases", ID: "id", Title: "name", Link: "url", Body: "notes"},
+		expected: []expectedItem{
+			{"7", "v1.0", "https://example.com/releases/1.0", "First"},
+			{"https://example.org/releases/1.1", "v1.1", "https://example.org/releases/1.1", ""},
+			{"v1.2", "v1.2", "", ""},
+		},
+	}, {
+		name:     "single object",
+		data:     document,
+		mapping:  &ItemMapping{Item: "$.data.latest", ID: "id", Title: "name"},
+		expected: []expectedItem{{"9", "v2.0", "", ""}},
+	}, {
+		name:    "wildcard",
+		data:    document,
+		mapping: &ItemMapping{Item: "$.data.releases[*]", Title: "name"},
+		expected: []expectedItem{
+			{"v1.0", "v1.0", "", ""},
+			{"v1.1", "v1.1", "", ""},
+			{"v1.2", "v1.2", "", ""},
+		},
+	}, {
+		name:     "top level array without a mapping",
+		data:     `["a", "b"]`,
+		mapping:  nil,
+		expected: []expectedItem{},
+	}, {
+		name:     "top level array",
+		data:     `[{"title": "a"}, {"title": "b"}]`,
+		mapping:  &ItemMapping{Title: "$.title"},
+		expected: []expectedItem{{"a", "a", "", ""}, {"b", "b", "", ""}},
+	}, {
+		name:     "missing fields",
+		data:     document,
+		mapping:  &ItemMapping{Item: "$.data.releases", Title: "title", Link: "link"},
+		expected: []expectedItem{},
+	}, {
+		name:     "item path matching nothing",
+		data:     document,
+		mapping:  &ItemMapping{Item: "$.data.items", Title: "name"},
+		expected: []expectedItem{},
+	}, {
+		name:     "index out of range",
+		data:     document,
+		mapping:  &ItemMapping{Item: "$.data.releases[10]", Title: "name"},
+		expected: []expectedItem{},
+	}} {
+		items, err := mapJSONItems([]byte(test.data), "https://example.com/api/releases", test.mapping)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, item := range items {
+			if item.FeedTitle != "example.com" {
+				t.Errorf("%s: got feed title %q", test.name, item.FeedTitle)
+			}
+		}
+		checkItems(t, test.name, items, test.expected)
+	}
+}
+
+func TestMapJSONItemsErrors(t *testing.T) {
+	if _, err := mapJSONItems([]byte(`{"items": [`), "https://example.com", &ItemMapping{}); err == nil {
+		t.Error("expected invalid json to fail")
+	}
+	if _, err := mapJSONItems([]byte(`{"items": []}`), "https://example.com", &ItemMapping{Item: "$.items[x]"}); err == nil {
+		t.Error("expected an invalid item path to fail")
+	}
+}
+
+func TestParseJSONDate(t *testing.T) {
+	expected := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	for _, value := range []string{
+		"1614834367",
+		"1614834367000",
+		"2021-03-04T05:06:07Z",
+		"Thu, 04 Mar 2021 05:06:07 +0000",
+	} {
+		if actual := parseJSONDate(value); !actual.Equal(expected) {
+			t.Errorf("parsing %q: got %v, want %v", value, actual, expected)
+		}
+	}
+
+	if actual := parseJSONDate("someday"); !actual.IsZero() {
+		t.Errorf("parsing an invalid date: got %v", actual)
+	}
+}
+
+func TestValidateJSONMapping(t *testing.T) {
+	if err := validateJSONMapping(nil); err != nil {
+		t.Error(err)
+	}
+	if err := validateJSONMapping(&ItemMapping{Item: "$.items", Title: "name", Link: "links[0].href"}); err != nil {
+		t.Error(err)
+	}
+	if err := validateJSONMapping(&ItemMapping{Item: "$.items", Title: "names[0"}); err == nil {
+		t.Error("expected an invalid title path to fail")
+	}
+}
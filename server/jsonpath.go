@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one step of a JSONPath expression: a member name, an array
+// index, or a wildcard selecting all members or elements.
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the subset of JSONPath made of $ or @ followed by
+// .name, ['name'], [index], [*] and .* steps. Paths without a leading $ or @
+// are relative to the current element, so id is the same as $.id.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(path, "$") || strings.HasPrefix(path, "@") {
+		path = path[1:]
+	} else if len(path) > 0 && path[0] != '[' && path[0] != '.' {
+		path = "." + path
+	}
+
+	steps := []jsonPathStep{}
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			name := path[:end]
+			if len(name) == 0 {
+				return nil, fmt.Errorf("invalid json path, missing name after .")
+			}
+			if name == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{key: name})
+			}
+			path = path[end:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path, missing ]")
+			}
+			inner := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+			if inner == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			} else if index, err := strconv.Atoi(inner); err == nil {
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			} else {
+				return nil, fmt.Errorf("invalid json path step [%s]", inner)
+			}
+		default:
+			return nil, fmt.Errorf("invalid json path, unexpected %q", path[0])
+		}
+	}
+
+	return steps, nil
+}
+
+// evalJSONPath returns all values a JSONPath selects from a decoded JSON value.
+func evalJSONPath(value interface{}, steps []jsonPathStep) []interface{} {
+	results := []interface{}{value}
+	for _, step := range steps {
+		next := []interface{}{}
+		for _, result := range results {
+			switch v := result.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					keys := make([]string, 0, len(v))
+					for key := range v {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, v[key])
+					}
+				} else if member, ok := v[step.key]; ok && !step.isIndex {
+					next = append(next, member)
+				}
+			case []interface{}:
+				if step.wildcard {
+					next = append(next, v...)
+				} else if step.isIndex {
+					index := step.index
+					if index < 0 {
+						index = len(v) + index
+					}
+					if index >= 0 && index < len(v) {
+						next = append(next, v[index])
+					}
+				}
+			}
+		}
+		results = next
+	}
+	return results
+}
+
+// jsonPathString returns the first value a JSONPath selects as a string, or
+// an empty string if it selects nothing.
+func jsonPathString(value interface{}, path string) string {
+	if len(path) == 0 {
+		return ""
+	}
+
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return ""
+	}
+
+	results := evalJSONPath(value, steps)
+	if len(results) == 0 {
+		return ""
+	}
+
+	switch v := results[0].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
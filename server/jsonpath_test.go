@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		expected []jsonPathStep
+	}{
+		{"$", []jsonPathStep{}},
+		{"", []jsonPathStep{}},
+		{"$.data.items", []jsonPathStep{{key: "data"}, {key: "items"}}},
+		{"data.items", []jsonPathStep{{key: "data"}, {key: "items"}}},
+		{"@.id", []jsonPathStep{{key: "id"}}},
+		{"$['odd.name'][\"other\"]", []jsonPathStep{{key: "odd.name"}, {key: "other"}}},
+		{"$.items[0]", []jsonPathStep{{key: "items"}, {index: 0, isIndex: true}}},
+		{"$.items[-1]", []jsonPathStep{{key: "items"}, {index: -1, isIndex: true}}},
+		{"$.items[*].id", []jsonPathStep{{key: "items"}, {wildcard: true}, {key: "id"}}},
+		{"$.*", []jsonPathStep{{wildcard: true}}},
+		{"[ 2 ]", []jsonPathStep{{index: 2, isIndex: true}}},
+	} {
+		steps, err := parseJSONPath(test.path)
+		if err != nil {
+			t.Errorf("parsing %q: %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(steps, test.expected) {
+			t.Errorf("parsing %q: got %+v, want %+v", test.path, steps, test.expected)
+		}
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, path := range []string{
+		"$..items",
+		"$.items.",
+		"$.items[0",
+		"$.items[abc]",
+		"$.items['unterminated]",
+		"$items",
+		"$.items[]",
+	} {
+		if steps, err := parseJSONPath(path); err == nil {
+			t.Errorf("expected parsing %q to fail, got %+v", path, steps)
+		}
+	}
+}
+
+func decodeTestJSON(t *testing.T, data string) interface{} {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestJSONPathString(t *testing.T) {
+	document := decodeTestJSON(t, `{
+		"title": "Releases",
+		"count": 3,
+		"draft": false,
+		"missing": null,
+		"items": [
+			{"id": 1, "name": "one", "tags": ["a", "b"]},
+			{"id": 2, "name": "two", "author": {"name": "Ann"}},
+			{"id": 3}
+		],
+		"meta": {"b": "second", "a": "first"}
+	}`)
+
+	for path, expected := range map[string]string{
+		"$.title":                "Releases",
+		"title":                  "Releases",
+		"$.count":                "3",
+		"$.draft":                "false",
+		"$.missing":              "",
+		"$.items[0].name":        "one",
+		"$.items[-1].id":         "3",
+		"$.items[5].id":          "",
+		"$.items[-5].id":         "",
+		"$.items[*].name":        "one",
+		"$.items[*].author.name": "Ann",
+		"$.items[0].tags":        `["a","b"]`,
+		"$.items[0].tags[1]":     "b",
+		"$.meta.*":               "first",
+		"$.nothing.here":         "",
+		"$.title.length":         "",
+		"$.items.name":           "",
+		"$.meta[0]":              "",
+		"$..broken":              "",
+		"":                       "",
+	} {
+		if actual := jsonPathString(document, path); actual != expected {
+			t.Errorf("evaluating %q: got %q, want %q", path, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	atomparser "github.com/wbernest/atom-parser"
+	rssv2parser "github.com/wbernest/rss-v2-parser"
+)
+
+// opmlDocument is an OPML 2.0 subscription list.
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []*opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// opmlOutline is either a feed, if it has an xmlUrl, or a folder of outlines.
+type opmlOutline struct {
+	Text     string         `xml:"text,attr"`
+	Title    string         `xml:"title,attr,omitempty"`
+	Type     string         `xml:"type,attr,omitempty"`
+	XMLURL   string         `xml:"xmlUrl,attr,omitempty"`
+	Outlines []*opmlOutline `xml:"outline"`
+}
+
+// opmlFeedTypes maps the outline types that can be imported to subscription types.
+var opmlFeedTypes = map[string]string{
+	"":     subscriptionTypeFeed,
+	"rss":  subscriptionTypeFeed,
+	"atom": subscriptionTypeFeed,
+	"ics":  subscriptionTypeICS,
+}
+
+// opmlFeeds returns the feed URLs and their subscription types of all
+// outlines, including those in folders.
+func opmlFeeds(outlines []*opmlOutline) [][2]string {
+	feeds := [][2]string{}
+	for _, outline := range outlines {
+		if subscriptionType, ok := opmlFeedTypes[strings.ToLower(outline.Type)]; ok && len(strings.TrimSpace(outline.XMLURL)) > 0 {
+			feeds = append(feeds, [2]string{strings.TrimSpace(outline.XMLURL), subscriptionType})
+		}
+		feeds = append(feeds, opmlFeeds(outline.Outlines)...)
+	}
+	return feeds
+}
+
+// importOPML subscribes a channel to every feed of the OPML file attached to
+// a post. Without a post ID, the user's most recent post with an attachment
+// in the channel is used. It returns the number of feeds subscribed to.
+func (p *RSSFeedPlugin) importOPML(userID string, channelID string, postID string) (int, error) {
+	post, err := p.findImportPost(userID, channelID, postID)
+	if err != nil {
+		return 0, err
+	}
+
+	var data []byte
+	for _, fileID := range post.FileIds {
+		info, appErr := p.API.GetFileInfo(fileID)
+		if appErr != nil {
+			continue
+		}
+		switch strings.ToLower(info.Extension) {
+		case "opml", "xml":
+		default:
+			continue
+		}
+		if data, appErr = p.API.GetFile(fileID); appErr != nil {
+			return 0, appErr
+		}
+		break
+	}
+	if data == nil {
+		return 0, errors.New("the post has no .opml or .xml attachment")
+	}
+
+	document := opmlDocument{}
+	if err := decodeFeedXML(string(data), &document); err != nil {
+		return 0, fmt.Errorf("invalid OPML file - %s", err.Error())
+	}
+
+	count := 0
+	for _, feed := range opmlFeeds(document.Body.Outlines) {
+		options := map[string]string{}
+		if feed[1] != subscriptionTypeFeed {
+			options["type"] = feed[1]
+		}
+		if err := p.subscribe(context.Background(), channelID, feed[0], options); err != nil {
+			p.API.LogError("Unable to import a feed",
+				"channel_id", channelID,
+				"url", redactURL(feed[0]),
+				"err", redactURLs(err.Error()))
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func (p *RSSFeedPlugin) findImportPost(userID string, channelID string, postID string) (*model.Post, error) {
+	if len(postID) > 0 {
+		// accept a permalink as well as a post ID
+		postID = postID[strings.LastIndex(postID, "/")+1:]
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil {
+			return nil, fmt.Errorf("unable to find post %s", postID)
+		}
+		if !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+			return nil, fmt.Errorf("unable to find post %s", postID)
+		}
+		return post, nil
+	}
+
+	posts, appErr := p.API.GetPostsForChannel(channelID, 0, 50)
+	if appErr != nil {
+		return nil, appErr
+	}
+	for _, id := range posts.Order {
+		post := posts.Posts[id]
+		if post.UserId == userID && len(post.FileIds) > 0 {
+			return post, nil
+		}
+	}
+
+	return nil, errors.New("please upload an OPML file to this channel first, or specify the link of the post it is attached to")
+}
+
+// exportOPML creates an OPML file of the subscriptions of a channel, or of all
+// channels if channelID is empty, and sends it to the user from the bot.
+func (p *RSSFeedPlugin) exportOPML(userID string, channelID string) error {
+	subscriptions, err := p.getSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	document := opmlDocument{Version: "2.0"}
+	document.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+	document.Head.Title = "RSSFeed subscriptions"
+
+	folders := map[string]*opmlOutline{}
+	count := 0
+	for _, subscription := range subscriptions.Subscriptions {
+		if len(channelID) > 0 && subscription.ChannelID != channelID {
+			continue
+		}
+		if subscription.Type != subscriptionTypeFeed && subscription.Type != subscriptionTypeICS {
+			continue
+		}
+
+		folder, ok := folders[subscription.ChannelID]
+		if !ok {
+			folder = &opmlOutline{Text: p.getChannelDisplayName(subscription.ChannelID)}
+			folders[subscription.ChannelID] = folder
+		}
+
+		outlineType := "rss"
+		if subscription.Type == subscriptionTypeICS {
+			outlineType = "ics"
+		}
+		title := subscriptionTitle(subscription)
+		folder.Outlines = append(folder.Outlines, &opmlOutline{
+			Text:   title,
+			Title:  title,
+			Type:   outlineType,
+			XMLURL: redactURL(subscription.URL),
+		})
+		count++
+	}
+
+	for _, folder := range folders {
+		sort.Slice(folder.Outlines, func(i, j int) bool { return folder.Outlines[i].XMLURL < folder.Outlines[j].XMLURL })
+		if len(channelID) > 0 {
+			document.Head.Title = folder.Text + " subscriptions"
+			document.Body.Outlines = folder.Outlines
+		} else {
+			document.Body.Outlines = append(document.Body.Outlines, folder)
+		}
+	}
+	sort.Slice(document.Body.Outlines, func(i, j int) bool { return document.Body.Outlines[i].Text < document.Body.Outlines[j].Text })
+
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+
+	channel, appErr := p.API.GetDirectChannel(p.botUserID, userID)
+	if appErr != nil {
+		return appErr
+	}
+
+	fileName := "subscriptions.opml"
+	if len(channelID) > 0 {
+		fileName = filepath.Base(strings.TrimPrefix(p.getChannelDisplayName(channelID), "~")) + ".opml"
+	}
+	info, appErr := p.API.UploadFile(data, channel.Id, fileName)
+	if appErr != nil {
+		return appErr
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   fmt.Sprintf("Exported %d subscriptions to OPML.", count),
+		FileIds:   []string{info.Id},
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+// getChannelDisplayName returns ~channel, prefixed with the team name if the
+// channel belongs to a team.
+func (p *RSSFeedPlugin) getChannelDisplayName(channelID string) string {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return channelID
+	}
+
+	if len(channel.TeamId) > 0 {
+		if team, appErr := p.API.GetTeam(channel.TeamId); appErr == nil {
+			return team.Name + " ~" + channel.Name
+		}
+	}
+	return "~" + channel.Name
+}
+
+// subscriptionTitle returns the title of a subscribed feed as of the last
+// check, or its URL.
+func subscriptionTitle(subscription *Subscription) string {
+	if subscription.Type == subscriptionTypeFeed && len(subscription.XML) > 0 {
+		if feed, err := rssv2parser.ParseString(subscription.XML); err == nil && len(feed.Channel.Title) > 0 {
+			return feed.Channel.Title
+		}
+		if feed, err := atomparser.ParseString(subscription.XML); err == nil && len(feed.Title) > 0 {
+			return feed.Title
+		}
+	}
+	return redactURL(subscription.URL)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// Values of the ManageSubscriptions setting.
+const (
+	managePolicyEveryone      = "everyone"
+	managePolicyChannelAdmins = "channel_admins"
+	managePolicyTeamAdmins    = "team_admins"
+	managePolicySystemAdmins  = "system_admins"
+)
+
+// commandManages lists the subcommands that change the subscriptions of a
+// channel and are therefore subject to the ManageSubscriptions setting.
+var commandManages = map[string]bool{
+	"subscribe":   true,
+	"unsubscribe": true,
+	"set":         true,
+	"filter":      true,
+	"auth":        true,
+	"route":       true,
+	"channel":     true,
+	"import":      true,
+}
+
+// canManageSubscriptions checks whether a user may change the subscriptions
+// of a channel according to the ManageSubscriptions setting. Subscriptions of
+// archived and read-only channels can't be changed by anyone, as their items
+// couldn't be posted.
+func (p *RSSFeedPlugin) canManageSubscriptions(userID string, channelID string) error {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return errors.New("unable to find the channel")
+	}
+
+	if channel.DeleteAt > 0 {
+		return errors.New("the subscriptions of archived channels can't be changed")
+	}
+
+	if channel.Name == model.DEFAULT_CHANNEL {
+		if config := p.API.GetConfig(); config != nil && config.TeamSettings.ExperimentalTownSquareIsReadOnly != nil && *config.TeamSettings.ExperimentalTownSquareIsReadOnly {
+			return errors.New("the subscriptions of read-only channels can't be changed")
+		}
+	}
+
+	if !p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_CREATE_POST) {
+		return errors.New("you do not have permission to post in this channel")
+	}
+
+	switch p.getConfiguration().ManageSubscriptions {
+	case managePolicyChannelAdmins:
+		if !p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_MANAGE_CHANNEL_ROLES) {
+			return errors.New("only channel admins can change the subscriptions of this channel")
+		}
+	case managePolicyTeamAdmins:
+		// direct and group messages belong to no team and fall back to system admins
+		if len(channel.TeamId) == 0 || !p.API.HasPermissionToTeam(userID, channel.TeamId, model.PERMISSION_MANAGE_TEAM) {
+			if !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+				return errors.New("only team admins can change the subscriptions of this channel")
+			}
+		}
+	case managePolicySystemAdmins:
+		if !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+			return errors.New("only system admins can change the subscriptions of this channel")
+		}
+	}
+
+	return nil
+}
@@ -10,7 +10,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/lunny/html2md"
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
 	atomparser "github.com/wbernest/atom-parser"
@@ -48,6 +47,8 @@ func (p *RSSFeedPlugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *h
 			w.Write([]byte("404 Something went wrong - " + http.StatusText(404)))
 			p.API.LogInfo("/images/rss.png err = ", err.Error())
 		}
+	case autocompleteSubscriptionsPath:
+		p.handleAutocompleteSubscriptions(w, r)
 	default:
 		w.Header().Set("Content-Type", "application/json")
 		http.NotFound(w, r)
@@ -79,9 +80,17 @@ func (p *RSSFeedPlugin) processHeartBeat() error {
 	}
 
 	for _, value := range dictionaryOfSubscriptions.Subscriptions {
+		if err := p.processQueue(value, time.Now()); err != nil {
+			p.API.LogError(redactURLs(err.Error()))
+		}
+
 		err := p.processSubscription(value)
 		if err != nil {
-			p.API.LogError(err.Error())
+			p.API.LogError(redactURLs(err.Error()))
+		}
+
+		if err := p.processDigest(value, time.Now()); err != nil {
+			p.API.LogError(redactURLs(err.Error()))
 		}
 	}
 
@@ -108,14 +117,37 @@ func (p *RSSFeedPlugin) processSubscription(subscription *Subscription) error {
 		return errors.New("no url supplied")
 	}
 
-	if rssv2parser.IsValidFeed(subscription.URL) {
-		err := p.processRSSV2Subscription(subscription)
+	switch subscription.Type {
+	case subscriptionTypeHTML:
+		if err := p.processHTMLSubscription(subscription); err != nil {
+			return fmt.Errorf("unable to scrape %s - %s", subscription.URL, err.Error())
+		}
+		return nil
+	case subscriptionTypeJSON:
+		if err := p.processJSONSubscription(subscription); err != nil {
+			return fmt.Errorf("invalid json feed %s - %s", subscription.URL, err.Error())
+		}
+		return nil
+	case subscriptionTypeICS:
+		if err := p.processICSSubscription(subscription); err != nil {
+			return fmt.Errorf("invalid iCalendar feed %s - %s", subscription.URL, err.Error())
+		}
+		return nil
+	}
+
+	data, err := p.fetch(subscription.URL, subscription, fetchTimeout, feedMaxBytes)
+	if err != nil {
+		return err
+	}
+
+	if newRssFeed, err := rssv2parser.ParseString(string(data)); err == nil && len(data) > 0 {
+		err := p.processRSSV2Subscription(subscription, newRssFeed, string(data))
 		if err != nil {
 			return fmt.Errorf("invalid RSS v2 feed format for %s - %s", subscription.URL, err.Error())
 		}
 
-	} else if atomparser.IsValidFeed(subscription.URL) {
-		err := p.processAtomSubscription(subscription)
+	} else if newFeed, err := atomparser.ParseString(string(data)); err == nil && len(data) > 0 {
+		err := p.processAtomSubscription(subscription, newFeed, string(data))
 		if err != nil {
 			return fmt.Errorf("invalid atom feed format for %s - %s", subscription.URL, err.Error())
 		}
@@ -126,15 +158,7 @@ func (p *RSSFeedPlugin) processSubscription(subscription *Subscription) error {
 	return nil
 }
 
-func (p *RSSFeedPlugin) processRSSV2Subscription(subscription *Subscription) error {
-	config := p.getConfiguration()
-
-	// get new rss feed string from url
-	newRssFeed, newRssFeedString, err := rssv2parser.ParseURL(subscription.URL)
-	if err != nil {
-		return err
-	}
-
+func (p *RSSFeedPlugin) processRSSV2Subscription(subscription *Subscription, newRssFeed *rssv2parser.RSSV2, newRssFeedString string) error {
 	// retrieve old xml feed from database
 	oldRssFeed, err := rssv2parser.ParseString(subscription.XML)
 	if err != nil {
@@ -142,6 +166,7 @@ func (p *RSSFeedPlugin) processRSSV2Subscription(subscription *Subscription) err
 	}
 
 	items := rssv2parser.CompareItemsBetweenOldAndNew(oldRssFeed, newRssFeed)
+	updated := p.findUpdatedRSSItems(oldRssFeed, newRssFeed)
 
 	// if this is a new subscription only post the latest
 	// and not spam the channel
@@ -149,48 +174,73 @@ func (p *RSSFeedPlugin) processRSSV2Subscription(subscription *Subscription) err
 		items = items[:1]
 	}
 
-	for _, item := range items {
-		post := ""
-
-		if config.FormatTitle {
-			post = post + "##### "
-		}
-		post = post + newRssFeed.Channel.Title + "\n"
-
-		if config.ShowRSSItemTitle {
-			if config.FormatTitle {
-				post = post + "###### "
-			}
-			post = post + item.Title + "\n"
-		}
-
-		if config.ShowRSSLink {
-			post = post + strings.TrimSpace(item.Link) + "\n"
-		}
-		if config.ShowDescription {
-			post = post + html2md.Convert(item.Description) + "\n"
-		}
+	categories := parseRSSCategories(newRssFeedString)
+
+	newItems := []*feedItem{}
+	for i := range items {
+		item := items[i]
+		newItems = append(newItems, &feedItem{
+			Key:        rssItemKey(&item),
+			FeedTitle:  newRssFeed.Channel.Title,
+			Title:      item.Title,
+			Link:       strings.TrimSpace(item.Link),
+			Content:    item.Description,
+			Categories: categories[rssItemKey(&item)],
+			Author:     item.Author,
+			Published:  parseFeedDate(item.PubDate),
+			format:     func() string { return p.formatRSSItem(subscription, newRssFeed, &item) },
+		})
+	}
+	p.deliverItems(subscription, newItems)
 
-		p.createBotPost(subscription.ChannelID, post, "custom_git_pr")
+	for _, update := range updated {
+		p.updateItemPost(subscription, rssItemKey(update.newItem), strings.TrimSpace(update.newItem.Link),
+			p.formatRSSItem(subscription, oldRssFeed, update.oldItem),
+			p.formatRSSItem(subscription, newRssFeed, update.newItem))
 	}
 
-	if len(items) > 0 {
+	if len(items) > 0 || len(updated) > 0 {
 		subscription.XML = newRssFeedString
-		p.updateSubscription(subscription)
+		subscription.prunePostIDs(rssItemKeys(newRssFeed))
+		p.updateSubscriptionState(subscription)
 	}
 
 	return nil
 }
 
-func (p *RSSFeedPlugin) processAtomSubscription(subscription *Subscription) error {
+func (p *RSSFeedPlugin) formatRSSItem(subscription *Subscription, feed *rssv2parser.RSSV2, item *rssv2parser.Item) string {
 	config := p.getConfiguration()
+	post := ""
 
-	// get new rss feed string from url
-	newFeed, newFeedString, err := atomparser.ParseURL(subscription.URL)
-	if err != nil {
-		return err
+	if config.FormatTitle {
+		post = post + "##### "
 	}
+	post = post + feed.Channel.Title + "\n"
 
+	if config.ShowRSSItemTitle {
+		if config.FormatTitle {
+			post = post + "###### "
+		}
+		post = post + item.Title + "\n"
+	}
+
+	if config.ShowRSSLink {
+		post = post + strings.TrimSpace(item.Link) + "\n"
+	}
+	if article := p.getFullArticle(subscription, strings.TrimSpace(item.Link)); len(article) > 0 {
+		post = post + article + "\n"
+	} else if config.ShowDescription {
+		base := strings.TrimSpace(item.Link)
+		if len(base) == 0 {
+			base = strings.TrimSpace(feed.Channel.Link)
+		}
+		post = post + renderHTML(item.Description, base) + "\n"
+	}
+
+	return post
+}
+
+func (p *RSSFeedPlugin) processAtomSubscription(subscription *Subscription, newFeed *atom.Feed, newFeedString string) error {
 	// retrieve old xml feed from database
 	oldFeed, err := atomparser.ParseString(subscription.XML)
 	if err != nil {
@@ -198,6 +248,7 @@ func (p *RSSFeedPlugin) processAtomSubscription(subscription *Subscription) erro
 	}
 
 	items := atomparser.CompareItemsBetweenOldAndNew(oldFeed, newFeed)
+	updated := p.findUpdatedAtomEntries(oldFeed, newFeed)
 
 	// if this is a new subscription only post the latest
 	// and not spam the channel
@@ -205,62 +256,153 @@ func (p *RSSFeedPlugin) processAtomSubscription(subscription *Subscription) erro
 		items = items[:1]
 	}
 
-	for _, item := range items {
-		post := ""
+	categories := parseAtomCategories(newFeedString)
+
+	newItems := []*feedItem{}
+	for i := range items {
+		item := items[i]
+		newItems = append(newItems, &feedItem{
+			Key:        item.ID,
+			FeedTitle:  newFeed.Title,
+			Title:      item.Title,
+			Link:       atomEntryLink(item),
+			Content:    atomEntryContent(item),
+			Categories: categories[item.ID],
+			Author:     atomEntryAuthor(newFeed, item),
+			Published:  atomEntryDate(item),
+			format:     func() string { return p.formatAtomEntry(subscription, newFeed, item) },
+		})
+	}
+	p.deliverItems(subscription, newItems)
+
+	for _, update := range updated {
+		p.updateItemPost(subscription, update.newEntry.ID, atomEntryLink(update.newEntry),
+			p.formatAtomEntry(subscription, oldFeed, update.oldEntry),
+			p.formatAtomEntry(subscription, newFeed, update.newEntry))
+	}
+
+	if len(items) > 0 || len(updated) > 0 {
+		subscription.XML = newFeedString
+		subscription.prunePostIDs(atomEntryKeys(newFeed))
+		p.updateSubscriptionState(subscription)
+	}
+
+	return nil
+}
+
+func (p *RSSFeedPlugin) formatAtomEntry(subscription *Subscription, feed *atom.Feed, item *atom.Entry) string {
+	config := p.getConfiguration()
+	post := ""
+
+	if config.FormatTitle {
+		post = post + "##### "
+	}
+	post = post + feed.Title + "\n"
 
+	if config.ShowAtomItemTitle {
 		if config.FormatTitle {
-			post = post + "##### "
+			post = post + "###### "
 		}
-		post = post + newFeed.Title + "\n"
+		post = post + item.Title + "\n"
+	}
 
-		if config.ShowAtomItemTitle {
-			if config.FormatTitle {
-				post = post + "###### "
+	if config.ShowAtomLink {
+		for _, link := range item.Link {
+			if link.Rel == "alternate" {
+				post = post + strings.TrimSpace(link.Href) + "\n"
 			}
-			post = post + item.Title + "\n"
 		}
+	}
 
-		if config.ShowAtomLink {
-			for _, link := range item.Link {
-				if link.Rel == "alternate" {
-					post = post + strings.TrimSpace(link.Href) + "\n"
-				}
-			}
+	if article := p.getFullArticle(subscription, atomEntryLink(item)); len(article) > 0 {
+		return post + article + "\n"
+	}
+
+	if config.ShowSummary {
+		if !tryParseRichNode(item.Summary, atomEntryBase(feed, item), &post) {
+			p.API.LogInfo("Missing summary in atom feed item",
+				"subscription_url", redactURL(subscription.URL),
+				"item_title", item.Title)
+			post = post + "\n"
 		}
+	}
 
-		if config.ShowSummary {
-			if !tryParseRichNode(item.Summary, &post) {
-				p.API.LogInfo("Missing summary in atom feed item",
-					"subscription_url", subscription.URL,
-					"item_title", item.Title)
-				post = post + "\n"
-			}
+	if config.ShowContent {
+		if !tryParseRichNode(item.Content, atomEntryBase(feed, item), &post) {
+			p.API.LogInfo("Missing content in atom feed item",
+				"subscription_url", redactURL(subscription.URL),
+				"item_title", item.Title)
+			post = post + "\n"
 		}
+	}
 
-		if config.ShowContent {
-			if !tryParseRichNode(item.Content, &post) {
-				p.API.LogInfo("Missing content in atom feed item",
-					"subscription_url", subscription.URL,
-					"item_title", item.Title)
-				post = post + "\n"
-			}
+	return post
+}
+
+// atomEntryLink returns the alternate link of an entry, or its first link if
+// it has no alternate link.
+func atomEntryLink(item *atom.Entry) string {
+	for _, link := range item.Link {
+		if link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
 		}
+	}
+	if len(item.Link) > 0 {
+		return strings.TrimSpace(item.Link[0].Href)
+	}
+	return ""
+}
 
-		p.createBotPost(subscription.ChannelID, post, "custom_git_pr")
+// atomEntryContent returns the summary and the content of an entry.
+func atomEntryContent(item *atom.Entry) string {
+	content := ""
+	for _, node := range []*atom.Text{item.Summary, item.Content} {
+		if node != nil {
+			content = content + node.Body + "\n"
+		}
 	}
+	return content
+}
 
-	if len(items) > 0 {
-		subscription.XML = newFeedString
-		p.updateSubscription(subscription)
+// atomEntryAuthor returns the name of the entry's author, falling back to the
+// author of the feed.
+func atomEntryAuthor(feed *atom.Feed, item *atom.Entry) string {
+	if item.Author != nil {
+		return item.Author.Name
+	}
+	if feed.Author != nil {
+		return feed.Author.Name
 	}
+	return ""
+}
 
-	return nil
+// atomEntryDate returns the date an entry was published, falling back to the
+// date it was last updated.
+func atomEntryDate(item *atom.Entry) time.Time {
+	if published := parseFeedDate(string(item.Published)); !published.IsZero() {
+		return published
+	}
+	return parseFeedDate(string(item.Updated))
 }
 
-func tryParseRichNode(node *atom.Text, post *string) bool {
+// atomEntryBase returns the URL relative links in an entry are resolved
+// against, which is the link of the entry or else the link of the feed.
+func atomEntryBase(feed *atom.Feed, item *atom.Entry) string {
+	if link := atomEntryLink(item); len(link) > 0 {
+		return link
+	}
+	for _, link := range feed.Link {
+		if link.Rel == "alternate" || len(link.Rel) == 0 {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
+
+func tryParseRichNode(node *atom.Text, base string, post *string) bool {
 	if node != nil {
 		if node.Type != "text" {
-			*post = *post + html2md.Convert(strings.TrimSpace(node.Body)) + "\n"
+			*post = *post + renderHTML(node.Body, base) + "\n"
 		} else {
 			*post = *post + node.Body + "\n"
 		}
@@ -270,10 +412,15 @@ func tryParseRichNode(node *atom.Text, post *string) bool {
 	}
 }
 
-func (p *RSSFeedPlugin) createBotPost(channelID string, message string, postType string) error {
+func (p *RSSFeedPlugin) createBotPost(channelID string, message string, postType string) (*model.Post, error) {
+	return p.createBotReply(channelID, "", message, postType)
+}
+
+func (p *RSSFeedPlugin) createBotReply(channelID string, rootID string, message string, postType string) (*model.Post, error) {
 	post := &model.Post{
 		UserId:    p.botUserID,
 		ChannelId: channelID,
+		RootId:    rootID,
 		Message:   message,
 		Type:      postType,
 		/*Props: map[string]interface{}{
@@ -282,10 +429,11 @@ func (p *RSSFeedPlugin) createBotPost(channelID string, message string, postType
 		},*/
 	}
 
-	if _, err := p.API.CreatePost(post); err != nil {
+	created, err := p.API.CreatePost(post)
+	if err != nil {
 		p.API.LogError(err.Error())
-		return err
+		return nil, err
 	}
 
-	return nil
+	return created, nil
 }
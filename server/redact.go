@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces secrets in redacted URLs.
+const redactedValue = "REDACTED"
+
+var (
+	// sensitiveParameters matches the names of query parameters that are
+	// likely to carry credentials, e.g. token, private_token or api_key.
+	sensitiveParameters = regexp.MustCompile(`(?i)token|secret|passw|pwd|api[_-]?key|^key$|^auth|^sig(nature)?$|session|credential`)
+
+	// urlPattern finds URLs in messages such as errors.
+	urlPattern = regexp.MustCompile("(?i)\\b[a-z][a-z0-9+.-]*://[^\\s\"'<>`]+")
+)
+
+// redactURL replaces the password and the values of sensitive query
+// parameters of a URL, so that it can be shown and logged. Parameters in the
+// fragment, such as an OAuth access_token, are redacted as well. The full URL
+// is only used to fetch the feed.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	redacted := false
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+		redacted = true
+	}
+
+	query, redactedQuery := redactParameters(u.RawQuery)
+	u.RawQuery = query
+
+	fragment, redactedFragment := redactParameters(u.EscapedFragment())
+	u.Fragment, u.RawFragment = "", ""
+
+	if !redacted && !redactedQuery && !redactedFragment {
+		return rawURL
+	}
+	if len(fragment) > 0 {
+		return u.String() + "#" + fragment
+	}
+	return u.String()
+}
+
+// redactParameters replaces the values of the sensitive parameters of a
+// query, and reports whether there were any.
+func redactParameters(query string) (string, bool) {
+	if len(query) == 0 {
+		return query, false
+	}
+
+	redacted := false
+	parameters := strings.Split(query, "&")
+	for i, parameter := range parameters {
+		name := strings.SplitN(parameter, "=", 2)[0]
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if sensitiveParameters.MatchString(name) && strings.Contains(parameter, "=") {
+			parameters[i] = strings.SplitN(parameter, "=", 2)[0] + "=" + redactedValue
+			redacted = true
+		}
+	}
+	return strings.Join(parameters, "&"), redacted
+}
+
+// redactURLs redacts all URLs in a message.
+func redactURLs(message string) string {
+	return urlPattern.ReplaceAllStringFunc(message, func(match string) string {
+		// punctuation ending a sentence is not part of the URL
+		trimmed := strings.TrimRight(match, ".,;:!?)")
+		return redactURL(trimmed) + match[len(trimmed):]
+	})
+}
+
+// matchesURL reports whether a URL given by a user refers to the URL of a
+// subscription, either in full or as shown redacted.
+func matchesURL(subscriptionURL string, givenURL string) bool {
+	return subscriptionURL == givenURL || redactURL(subscriptionURL) == givenURL
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// droppedElements are removed together with their content when rendering.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Svg:      true,
+	atom.Canvas:   true,
+	atom.Template: true,
+	atom.Head:     true,
+}
+
+// blockElements are rendered as paragraphs of their own.
+var blockElements = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Div:        true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Header:     true,
+	atom.Footer:     true,
+	atom.Aside:      true,
+	atom.Main:       true,
+	atom.Nav:        true,
+	atom.Figure:     true,
+	atom.Figcaption: true,
+	atom.Address:    true,
+	atom.Details:    true,
+	atom.Summary:    true,
+	atom.Dl:         true,
+	atom.Dt:         true,
+	atom.Dd:         true,
+}
+
+// trackingSources are parts of image URLs used by common feed analytics.
+var trackingSources = []string{
+	"feeds.feedburner.com/~r/",
+	"feeds.feedburner.com/~ff/",
+	"stats.wordpress.com/",
+	"pixel.wp.com/",
+	"/tracking/",
+	"/pixel.gif",
+	"/pixel.png",
+	"/open.gif",
+	"doubleclick.net/",
+	"google-analytics.com/",
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// markdownRenderer converts sanitized HTML to Mattermost markdown.
+type markdownRenderer struct {
+	// base resolves relative links and image sources, if known.
+	base *url.URL
+}
+
+// renderHTML converts the HTML content of a feed item to Mattermost markdown.
+// Scripts, forms, embedded frames, tracking pixels and empty elements are
+// dropped, and relative URLs are resolved against base, typically the link of
+// the item or of the feed.
+func renderHTML(content string, base string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return strings.TrimSpace(content)
+	}
+
+	return renderHTMLNode(doc, base)
+}
+
+// renderHTMLNode converts a parsed HTML node to Mattermost markdown.
+func renderHTMLNode(n *html.Node, base string) string {
+	return cleanMarkdown(newMarkdownRenderer(base).render(n))
+}
+
+// resolveURL makes a URL found in a page absolute, dropping URLs with unsafe
+// schemes.
+func resolveURL(base string, ref string) string {
+	return newMarkdownRenderer(base).resolve(ref)
+}
+
+func newMarkdownRenderer(base string) *markdownRenderer {
+	r := &markdownRenderer{}
+	if u, err := url.Parse(strings.TrimSpace(base)); err == nil && u.IsAbs() {
+		r.base = u
+	}
+	return r
+}
+
+func (r *markdownRenderer) renderChildren(n *html.Node) string {
+	var out strings.Builder
+	afterBreak := false
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		text := r.render(child)
+		if child.Type == html.ElementNode && child.DataAtom == atom.Br {
+			trimmed := strings.TrimRight(out.String(), " ")
+			out.Reset()
+			out.WriteString(trimmed)
+			afterBreak = true
+		} else if afterBreak {
+			text = strings.TrimLeft(text, " ")
+			afterBreak = len(text) == 0
+		}
+		out.WriteString(text)
+	}
+	return out.String()
+}
+
+func (r *markdownRenderer) render(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return collapseWhitespace(n.Data)
+	case html.DocumentNode:
+		return r.renderChildren(n)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if droppedElements[n.DataAtom] || isHidden(n) {
+		return ""
+	}
+
+	if blockElements[n.DataAtom] {
+		return block(r.renderChildren(n))
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.Hr:
+		return "\n\n---\n\n"
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return block(wrapInline(strings.Replace(r.renderChildren(n), "\n", " ", -1), "**"))
+	case atom.Strong, atom.B:
+		return wrapInline(r.renderChildren(n), "**")
+	case atom.Em, atom.I, atom.Cite:
+		return wrapInline(r.renderChildren(n), "_")
+	case atom.Del, atom.S, atom.Strike:
+		return wrapInline(r.renderChildren(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		code := strings.TrimSpace(textContent(n))
+		if len(code) == 0 {
+			return ""
+		}
+		return "`" + code + "`"
+	case atom.Pre:
+		code := strings.Trim(textContent(n), "\n")
+		if len(strings.TrimSpace(code)) == 0 {
+			return ""
+		}
+		return "\n\n```\n" + code + "\n```\n\n"
+	case atom.Blockquote:
+		inner := cleanMarkdown(r.renderChildren(n))
+		if len(inner) == 0 {
+			return ""
+		}
+		return block("> " + strings.Replace(inner, "\n", "\n> ", -1))
+	case atom.Ul, atom.Ol:
+		return r.renderList(n)
+	case atom.Li:
+		return block(r.renderChildren(n))
+	case atom.Table:
+		return r.renderTable(n)
+	case atom.A:
+		return r.renderLink(n)
+	case atom.Img:
+		return r.renderImage(n)
+	default:
+		return r.renderChildren(n)
+	}
+}
+
+func (r *markdownRenderer) renderLink(n *html.Node) string {
+	inner := strings.TrimSpace(r.renderChildren(n))
+	href := r.resolve(getAttribute(n, "href"))
+	if len(inner) == 0 || len(href) == 0 || strings.HasPrefix(href, "#") {
+		return inner
+	}
+	if inner == href {
+		return href
+	}
+	return fmt.Sprintf("[%s](%s)", inner, href)
+}
+
+func (r *markdownRenderer) renderImage(n *html.Node) string {
+	src := r.resolve(getAttribute(n, "src"))
+	if len(src) == 0 || isTrackingPixel(n, src) {
+		return ""
+	}
+	return fmt.Sprintf("![%s](%s)", collapseWhitespace(getAttribute(n, "alt")), src)
+}
+
+func (r *markdownRenderer) renderList(n *html.Node) string {
+	lines := []string{}
+	number := 1
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.DataAtom != atom.Li {
+			continue
+		}
+
+		item := cleanMarkdown(r.renderChildren(child))
+		if len(item) == 0 {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+
+		for i, line := range strings.Split(item, "\n") {
+			if len(strings.TrimSpace(line)) == 0 {
+				continue
+			}
+			if i == 0 {
+				lines = append(lines, marker+line)
+			} else {
+				lines = append(lines, strings.Repeat(" ", len(marker))+line)
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n" + strings.Join(lines, "\n") + "\n\n"
+}
+
+func (r *markdownRenderer) renderTable(n *html.Node) string {
+	rows := [][]string{}
+	columns := 0
+	hasContent := false
+
+	var collectRows func(*html.Node)
+	collectRows = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode || child.DataAtom == atom.Table {
+				continue
+			}
+			if child.DataAtom != atom.Tr {
+				collectRows(child)
+				continue
+			}
+
+			row := []string{}
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+					continue
+				}
+				text := cleanMarkdown(r.renderChildren(cell))
+				text = strings.Join(strings.Fields(text), " ")
+				text = strings.Replace(text, "|", "\\|", -1)
+				hasContent = hasContent || len(text) > 0
+				row = append(row, text)
+			}
+
+			if len(row) > 0 {
+				rows = append(rows, row)
+				if len(row) > columns {
+					columns = len(row)
+				}
+			}
+		}
+	}
+	collectRows(n)
+
+	if !hasContent {
+		return ""
+	}
+
+	lines := []string{}
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+
+	return "\n\n" + strings.Join(lines, "\n") + "\n\n"
+}
+
+// resolve makes a URL absolute and drops URLs with schemes other than http,
+// https and mailto, such as javascript: and data:.
+func (r *markdownRenderer) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if len(ref) == 0 {
+		return ""
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if r.base != nil {
+		u = r.base.ResolveReference(u)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return u.String()
+	default:
+		return ""
+	}
+}
+
+// isHidden reports whether an element is hidden from view by its attributes.
+func isHidden(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Key == "hidden" || (a.Key == "aria-hidden" && a.Val == "true") {
+			return true
+		}
+	}
+	style := strings.ToLower(strings.Replace(getAttribute(n, "style"), " ", "", -1))
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// isTrackingPixel reports whether an image is a tiny or known analytics image.
+func isTrackingPixel(n *html.Node, src string) bool {
+	for _, dimension := range []string{"width", "height"} {
+		value := strings.TrimSuffix(strings.TrimSpace(getAttribute(n, dimension)), "px")
+		if value == "0" || value == "1" {
+			return true
+		}
+	}
+
+	style := strings.ToLower(strings.Replace(getAttribute(n, "style"), " ", "", -1))
+	for _, tiny := range []string{"width:0", "width:1px", "height:0", "height:1px"} {
+		if strings.Contains(style, tiny) {
+			return true
+		}
+	}
+
+	lowerSrc := strings.ToLower(src)
+	for _, source := range trackingSources {
+		if strings.Contains(lowerSrc, source) {
+			return true
+		}
+	}
+	return false
+}
+
+func getAttribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var out strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.DataAtom == atom.Br {
+			out.WriteString("\n")
+			continue
+		}
+		out.WriteString(textContent(child))
+	}
+	return out.String()
+}
+
+// collapseWhitespace replaces runs of whitespace with a single space, the way
+// browsers render text outside of pre elements.
+func collapseWhitespace(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		if len(text) > 0 {
+			return " "
+		}
+		return ""
+	}
+
+	collapsed := strings.Join(fields, " ")
+	if strings.TrimLeft(text, " \t\r\n") != text {
+		collapsed = " " + collapsed
+	}
+	if strings.TrimRight(text, " \t\r\n") != text {
+		collapsed = collapsed + " "
+	}
+	return collapsed
+}
+
+// wrapInline surrounds inline content with a markdown marker, keeping the
+// surrounding whitespace outside of the markers. Empty content is dropped.
+func wrapInline(content string, marker string) string {
+	trimmed := strings.TrimSpace(content)
+	if len(trimmed) == 0 {
+		return strings.Replace(content, "\n", "", -1)
+	}
+
+	out := marker + trimmed + marker
+	if strings.TrimLeft(content, " ") != content {
+		out = " " + out
+	}
+	if strings.TrimRight(content, " ") != content {
+		out = out + " "
+	}
+	return out
+}
+
+// block renders content as a paragraph of its own, dropping it if it is empty.
+func block(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if len(trimmed) == 0 {
+		return ""
+	}
+	return "\n\n" + trimmed + "\n\n"
+}
+
+// cleanMarkdown removes trailing whitespace from every line and collapses
+// runs of blank lines.
+func cleanMarkdown(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
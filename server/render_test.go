@@ -0,0 +1,11 @@
+package main
+
+import "testing"
+
+// TestRenderHTML renders every testdata/render/*.html file, see
+// testGoldenFiles.
+func TestRenderHTML(t *testing.T) {
+	testGoldenFiles(t, "render", func(input string) string {
+		return renderHTML(input, "https://example.com/blog/post.html")
+	})
+}
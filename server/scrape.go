@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// validateHTMLMapping makes sure an html subscription has an item selector
+// and all of its selectors can be compiled.
+func validateHTMLMapping(mapping *ItemMapping) error {
+	if mapping == nil || len(mapping.Item) == 0 {
+		return errors.New("please specify the css selector of the items with --item")
+	}
+
+	for _, selector := range mapping.fields() {
+		if len(selector[1]) == 0 {
+			continue
+		}
+		if _, err := cascadia.Compile(selector[1]); err != nil {
+			return fmt.Errorf("invalid %s selector %s - %s", selector[0], selector[1], err.Error())
+		}
+	}
+	return nil
+}
+
+func (p *RSSFeedPlugin) processHTMLSubscription(subscription *Subscription) error {
+	if err := validateHTMLMapping(subscription.Mapping); err != nil {
+		return err
+	}
+
+	page, err := p.fetch(subscription.URL, subscription, fetchTimeout, feedMaxBytes)
+	if err != nil {
+		return err
+	}
+
+	items, err := scrapeItems(string(page), subscription.URL, subscription.Mapping)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		item := item
+		item.format = func() string { return p.formatFeedItem(subscription, item) }
+	}
+
+	p.processSyntheticItems(subscription, items)
+	return nil
+}
+
+// scrapeItems derives feed items from a web page using the CSS selectors of
+// a mapping. Relative links are resolved against the URL of the page.
+func scrapeItems(page string, pageURL string, selectors *ItemMapping) ([]*feedItem, error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+
+	itemSelector, err := cascadia.Compile(selectors.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	feedTitle := pageURL
+	if title := cascadia.MustCompile("title").MatchFirst(doc); title != nil {
+		if text := strings.TrimSpace(textContent(title)); len(text) > 0 {
+			feedTitle = text
+		}
+	}
+
+	items := []*feedItem{}
+	for _, node := range itemSelector.MatchAll(doc) {
+		item := &feedItem{FeedTitle: feedTitle}
+
+		titleNode := matchFirst(node, selectors.Title)
+		if titleNode == nil {
+			titleNode = firstHeading(node)
+		}
+		if titleNode != nil {
+			item.Title = strings.Join(strings.Fields(textContent(titleNode)), " ")
+		}
+
+		linkNode := matchFirst(node, selectors.Link)
+		if linkNode == nil {
+			linkNode = matchFirst(node, "a[href]")
+		}
+		if linkNode != nil {
+			href := getAttribute(linkNode, "href")
+			if len(href) == 0 {
+				href = textContent(linkNode)
+			}
+			item.Link = resolveURL(pageURL, href)
+		}
+
+		if dateNode := matchFirst(node, selectors.Date); dateNode != nil {
+			date := getAttribute(dateNode, "datetime")
+			if len(date) == 0 {
+				date = textContent(dateNode)
+			}
+			item.Published = parseFeedDate(date)
+		}
+
+		if bodyNode := matchFirst(node, selectors.Body); bodyNode != nil {
+			var body bytes.Buffer
+			if err := html.Render(&body, bodyNode); err == nil {
+				item.Content = body.String()
+			}
+		}
+
+		if idNode := matchFirst(node, selectors.ID); idNode != nil {
+			item.Key = strings.TrimSpace(textContent(idNode))
+		}
+		if len(item.Key) == 0 {
+			item.Key = item.Link
+		}
+		if len(item.Key) == 0 {
+			item.Key = item.Title
+		}
+		if len(item.Key) == 0 {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// matchFirst returns the first element below n matching a selector, or n
+// itself if it matches. An empty or invalid selector matches nothing.
+func matchFirst(n *html.Node, selector string) *html.Node {
+	if len(selector) == 0 {
+		return nil
+	}
+
+	compiled, err := cascadia.Compile(selector)
+	if err != nil {
+		return nil
+	}
+
+	if compiled.Match(n) {
+		return n
+	}
+	return compiled.MatchFirst(n)
+}
+
+func firstHeading(n *html.Node) *html.Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			switch child.DataAtom {
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				return child
+			}
+			if heading := firstHeading(child); heading != nil {
+				return heading
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+const testPage = `<html>
+<head><title> Project News </title></head>
+<body>
+	<article class="entry">
+		<h2><a href="/news/1">First
+			release</a></h2>
+		<time datetime="2021-03-04T05:06:07Z">March 4</time>
+		<div class="summary"><p>Hello</p></div>
+	</article>
+	<article class="entry" id="second">
+		<span class="name">Second</span>
+		<a class="more" href="https://example.org/news/2">More</a>
+	</article>
+	<article class="entry"><p>Neither a title nor a link</p></article>
+</body>
+</html>`
+
+func TestScrapeItems(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		mapping  *ItemMapping
+		expected []expectedItem
+	}{{
+		name:    "headings and links",
+		mapping: &ItemMapping{Item: "article.entry"},
+		expected: []expectedItem{
+			{"https://example.com/news/1", "First release", "https://example.com/news/1", ""},
+			{"https://example.org/news/2", "", "https://example.org/news/2", ""},
+		},
+	}, {
+		name:    "selectors",
+		mapping: &ItemMapping{Item: "article.entry", Title: "h2, .name", Link: "a.more", Body: ".summary"},
+		expected: []expectedItem{
+			{"https://example.com/news/1", "First release", "https://example.com/news/1", `<div class="summary"><p>Hello</p></div>`},
+			{"https://example.org/news/2", "Second", "https://example.org/news/2", ""},
+		},
+	}, {
+		name:     "item by id",
+		mapping:  &ItemMapping{Item: "#second", ID: "#second .more", Title: ".name"},
+		expected: []expectedItem{{"More", "Second", "https://example.org/news/2", ""}},
+	}, {
+		name:    "selectors matching nothing",
+		mapping: &ItemMapping{Item: "article.entry", ID: ".id", Title: "h5", Link: "a.missing", Body: ".missing"},
+		expected: []expectedItem{
+			{"https://example.com/news/1", "First release", "https://example.com/news/1", ""},
+			{"https://example.org/news/2", "", "https://example.org/news/2", ""},
+		},
+	}, {
+		name:     "item selector matching nothing",
+		mapping:  &ItemMapping{Item: "li.entry"},
+		expected: []expectedItem{},
+	}} {
+		items, err := scrapeItems(testPage, "https://example.com/news/", test.mapping)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, item := range items {
+			if item.FeedTitle != "Project News" {
+				t.Errorf("%s: got feed title %q", test.name, item.FeedTitle)
+			}
+		}
+		checkItems(t, test.name, items, test.expected)
+	}
+}
+
+func TestScrapeItemsDates(t *testing.T) {
+	items, err := scrapeItems(testPage, "https://example.com/news/", &ItemMapping{Item: "article.entry", Date: "time"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items", len(items))
+	}
+
+	expected := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	if !items[0].Published.Equal(expected) {
+		t.Errorf("got %v, want %v", items[0].Published, expected)
+	}
+	if !items[1].Published.IsZero() {
+		t.Errorf("got %v for an item without a date", items[1].Published)
+	}
+}
+
+func TestValidateHTMLMapping(t *testing.T) {
+	for _, mapping := range []*ItemMapping{
+		nil,
+		{},
+		{Title: "h2"},
+		{Item: "article["},
+		{Item: "article", Link: "a[href"},
+	} {
+		if err := validateHTMLMapping(mapping); err == nil {
+			t.Errorf("expected %+v to be invalid", mapping)
+		}
+	}
+
+	if err := validateHTMLMapping(&ItemMapping{Item: "article.entry", Title: "h2", Link: "a[href]"}); err != nil {
+		t.Error(err)
+	}
+}
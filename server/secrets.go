@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// storedSubscriptions is how subscriptions are stored in the KV store. The
+// URL and the last content of subscriptions may contain tokens, so they are
+// encrypted, and subscriptions are keyed by a hash of their URL instead.
+type storedSubscriptions struct {
+	Subscriptions map[string]*Subscription
+}
+
+// getStorageKey returns the key of a subscription in storedSubscriptions.
+func getStorageKey(subscription *Subscription) string {
+	return fmt.Sprintf("%s/%x", subscription.ChannelID, sha256.Sum256([]byte(subscription.URL)))
+}
+
+// encodeSubscriptions encrypts the secrets of subscriptions for storage.
+// Without an encryption key they are stored as they are.
+func encodeSubscriptions(s *Subscriptions, key string) ([]byte, error) {
+	stored := &storedSubscriptions{Subscriptions: map[string]*Subscription{}}
+
+	// keep what can't be decrypted, in case the previous key is restored
+	for storageKey, subscription := range s.undecryptable {
+		stored.Subscriptions[storageKey] = subscription
+	}
+
+	for _, subscription := range s.Subscriptions {
+		encoded := *subscription
+		if len(key) > 0 {
+			url, err := encryptWithKey(key, []byte(subscription.URL))
+			if err != nil {
+				return nil, err
+			}
+			xml, err := encryptWithKey(key, []byte(subscription.XML))
+			if err != nil {
+				return nil, err
+			}
+			encoded.URL, encoded.XML, encoded.Encrypted = url, xml, true
+		}
+		stored.Subscriptions[getStorageKey(subscription)] = &encoded
+	}
+
+	return json.Marshal(stored)
+}
+
+// decodeSubscriptions decrypts stored subscriptions with the first of the
+// keys that fits. Subscriptions that can't be decrypted with any of them
+// are kept aside. Credentials stay encrypted, but are re-encrypted with the
+// first key if another one fit.
+func decodeSubscriptions(value []byte, keys ...string) (*Subscriptions, error) {
+	stored := &storedSubscriptions{}
+	if err := json.Unmarshal(value, stored); err != nil {
+		return nil, err
+	}
+
+	s := &Subscriptions{
+		Subscriptions: map[string]*Subscription{},
+		undecryptable: map[string]*Subscription{},
+	}
+
+	for storageKey, subscription := range stored.Subscriptions {
+		if subscription.Encrypted {
+			url, index, err := decryptWithKeyIndex(subscription.URL, keys...)
+			if err != nil {
+				s.undecryptable[storageKey] = subscription
+				continue
+			}
+			xml, err := decryptWithKeys(subscription.XML, keys...)
+			if err != nil {
+				s.undecryptable[storageKey] = subscription
+				continue
+			}
+			subscription.URL, subscription.XML, subscription.Encrypted = string(url), string(xml), false
+			s.migrate = s.migrate || index > 0
+		} else {
+			// stored before secrets were encrypted
+			s.migrate = true
+		}
+
+		if len(subscription.Auth) > 0 && len(keys) > 1 {
+			auth, index, err := decryptWithKeyIndex(subscription.Auth, keys...)
+			if err == nil && index > 0 {
+				if subscription.Auth, err = encryptWithKey(keys[0], auth); err != nil {
+					return nil, err
+				}
+				s.migrate = true
+			}
+		}
+
+		s.Subscriptions[getKey(subscription.ChannelID, subscription.URL)] = subscription
+	}
+
+	return s, nil
+}
+
+// migrateSecrets stores the subscriptions again if any of their secrets are
+// stored in plain text or were encrypted with previousKey, so that they are
+// encrypted with the current key.
+func (p *RSSFeedPlugin) migrateSecrets(previousKey string) error {
+	key := p.getConfiguration().EncryptionKey
+	if len(key) == 0 {
+		return nil
+	}
+
+	value, appErr := p.API.KVGet(SUBSCRIPTIONS_KEY)
+	if appErr != nil {
+		return appErr
+	}
+	if value == nil {
+		return nil
+	}
+
+	keys := []string{key}
+	if len(previousKey) > 0 {
+		keys = append(keys, previousKey)
+	}
+	subscriptions, err := decodeSubscriptions(value, keys...)
+	if err != nil {
+		return err
+	}
+
+	if len(subscriptions.undecryptable) > 0 {
+		p.API.LogError(fmt.Sprintf("Unable to decrypt %d subscriptions, the encryption key may have changed", len(subscriptions.undecryptable)))
+	}
+	if !subscriptions.migrate {
+		return nil
+	}
+
+	p.API.LogInfo("Encrypting the secrets of subscriptions with the current encryption key")
+	return p.storeSubscriptions(subscriptions)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestSubscriptions() *Subscriptions {
+	subscription := &Subscription{
+		ChannelID: "channel",
+		URL:       "https://example.com/feed?token=secret-token",
+		XML:       "<rss>secret-content</rss>",
+	}
+	return &Subscriptions{Subscriptions: map[string]*Subscription{
+		getKey(subscription.ChannelID, subscription.URL): subscription,
+	}}
+}
+
+func TestEncodeSubscriptions(t *testing.T) {
+	value, err := encodeSubscriptions(newTestSubscriptions(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-token", "secret-content", "example.com"} {
+		if bytes.Contains(value, []byte(secret)) {
+			t.Errorf("%s is readable in the stored subscriptions", secret)
+		}
+	}
+
+	decoded, err := decodeSubscriptions(value, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription := decoded.Subscriptions["channel/https://example.com/feed?token=secret-token"]
+	if subscription == nil || subscription.XML != "<rss>secret-content</rss>" || subscription.Encrypted {
+		t.Fatalf("unexpected decoded subscriptions %v", decoded.Subscriptions)
+	}
+	if decoded.migrate {
+		t.Errorf("subscriptions encrypted with the current key should not be migrated")
+	}
+}
+
+func TestDecodeSubscriptionsStoredInPlainText(t *testing.T) {
+	value, err := encodeSubscriptions(newTestSubscriptions(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(value, []byte("secret-token")) {
+		t.Fatalf("expected subscriptions to be stored as they are without a key")
+	}
+
+	decoded, err := decodeSubscriptions(value, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Subscriptions) != 1 || !decoded.migrate {
+		t.Errorf("expected the plain text subscription to be decoded and migrated, got %v", decoded)
+	}
+}
+
+func TestDecodeSubscriptionsWithKeyRotation(t *testing.T) {
+	subscriptions := newTestSubscriptions()
+	for _, subscription := range subscriptions.Subscriptions {
+		auth, err := encryptWithKey("old key", []byte(`{"Token":"secret"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subscription.Auth = auth
+	}
+	value, err := encodeSubscriptions(subscriptions, "old key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeSubscriptions(value, "new key", "old key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Subscriptions) != 1 || !decoded.migrate {
+		t.Fatalf("expected the subscription to be decoded with the old key and migrated, got %v", decoded)
+	}
+	for _, subscription := range decoded.Subscriptions {
+		if auth, err := decryptWithKeys(subscription.Auth, "new key"); err != nil || string(auth) != `{"Token":"secret"}` {
+			t.Errorf("the credentials were not re-encrypted with the new key: %q, %v", auth, err)
+		}
+	}
+
+	// once stored again, the old key is no longer needed
+	value, err = encodeSubscriptions(decoded, "new key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = decodeSubscriptions(value, "new key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Subscriptions) != 1 || decoded.migrate {
+		t.Errorf("expected the subscription to be encrypted with the new key, got %v", decoded)
+	}
+}
+
+func TestDecodeSubscriptionsWithWrongKey(t *testing.T) {
+	value, err := encodeSubscriptions(newTestSubscriptions(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeSubscriptions(value, "wrong key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Subscriptions) != 0 || len(decoded.undecryptable) != 1 {
+		t.Fatalf("expected the subscription to be kept aside, got %v", decoded)
+	}
+
+	// storing again keeps what can't be decrypted, so the right key still works
+	value, err = encodeSubscriptions(decoded, "wrong key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = decodeSubscriptions(value, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Subscriptions) != 1 {
+		t.Errorf("the subscription was lost after storing it with a wrong key: %v", decoded)
+	}
+}
+
+func TestMigrateSecrets(t *testing.T) {
+	p, api := newTestPlugin()
+	p.setConfiguration(&configuration{EncryptionKey: "old key"})
+	if err := p.storeSubscriptions(newTestSubscriptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	p.setConfiguration(&configuration{EncryptionKey: "new key"})
+	if err := p.migrateSecrets("old key"); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeSubscriptions(api.kv[SUBSCRIPTIONS_KEY], "new key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Subscriptions) != 1 {
+		t.Errorf("expected the subscription to be re-encrypted with the new key, got %v", decoded)
+	}
+}
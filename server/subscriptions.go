@@ -1,10 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Subscription Object
@@ -12,6 +14,70 @@ type Subscription struct {
 	ChannelID string
 	URL       string
 	XML       string
+	// PostIDs maps the key of every posted feed item to the ID of the post
+	// created for it, so the post can be edited when the item changes.
+	PostIDs map[string]string
+	// Thread is either empty or the period after which a new root post is
+	// started for the items of the subscription.
+	Thread          string
+	RootPostID      string
+	RootPostCreated int64
+	// Digest is either empty or the schedule, e.g. daily@09:00, on which the
+	// queued items of the subscription are posted as one digest.
+	Digest         string
+	DigestLastSent int64
+	// Timezone is the IANA time zone used for digests, threads and the
+	// delivery window.
+	Timezone string
+	// Window is either empty or the times, e.g. mon-fri@08:00-18:00, during
+	// which items are posted. Items arriving outside of it are queued.
+	Window string
+	// Filters are the include and exclude rules added with /feed filter.
+	Filters []*Filter
+	// Categories restricts the subscription to items in one of them.
+	Categories []string
+	// Routes maps categories to the IDs of the channels their items are
+	// posted to instead of the subscribed channel.
+	Routes map[string]string
+	// RouteThreads are the threads of threaded subscriptions in the channels
+	// of their routes, by channel ID.
+	RouteThreads map[string]*RouteThread
+	// MaxAge is the number of days after which items are no longer posted,
+	// or zero to use the MaxItemAge setting.
+	MaxAge int
+	// MaxPosts is the number of items posted per cycle before the rest is
+	// collapsed into one post, or zero to use the MaxPostsPerCycle setting.
+	MaxPosts int
+	// FullArticle replaces the content of items with the main text of the
+	// page they link to.
+	FullArticle bool
+	// Insecure skips the verification of the TLS certificate of the host of
+	// the URL, e.g. for internal services with self-signed certificates.
+	Insecure bool
+	// Auth are the encrypted credentials sent with the requests to the host
+	// of the URL, see feedAuth.
+	Auth string
+	// Type is empty for RSS and Atom feeds, or the type of a synthetic feed
+	// whose items are derived by the plugin.
+	Type string
+	// Mapping derives the items of synthetic feeds.
+	Mapping *ItemMapping
+	// ItemKeys are the keys of the items of a synthetic feed at the last check.
+	ItemKeys []string
+	// Remind is the number of minutes before the start of the events of an
+	// ics subscription a reminder is posted, or zero for no reminders.
+	Remind int
+	// Reminded are the events of an ics subscription already reminded of.
+	Reminded []string
+	// Encrypted is set in storage if URL and XML are encrypted, see
+	// storedSubscriptions.
+	Encrypted bool
+}
+
+// RouteThread is the current root post of a thread in the channel of a route.
+type RouteThread struct {
+	RootPostID      string
+	RootPostCreated int64
 }
 
 const SUBSCRIPTIONS_KEY = "subscriptions"
@@ -19,16 +85,36 @@ const SUBSCRIPTIONS_KEY = "subscriptions"
 // Subscriptions map to key value pairs
 type Subscriptions struct {
 	Subscriptions map[string]*Subscription
+
+	// undecryptable are the stored subscriptions that can't be decrypted with
+	// the current encryption key, by their storage keys.
+	undecryptable map[string]*Subscription
+	// migrate is set if stored secrets are not encrypted with the current key.
+	migrate bool
 }
 
 // Subscribe prosses the /feed subscribe <channel> <url>
-func (p *RSSFeedPlugin) subscribe(ctx context.Context, channelID string, url string) error {
+func (p *RSSFeedPlugin) subscribe(ctx context.Context, channelID string, url string, options map[string]string) error {
 	sub := &Subscription{
 		ChannelID: channelID,
 		URL:       url,
 		XML:       "",
 	}
 
+	for name, value := range options {
+		if err := sub.setOption(name, value); err != nil {
+			return err
+		}
+	}
+
+	if err := sub.validate(); err != nil {
+		return err
+	}
+
+	if err := p.checkFetchURL(url); err != nil {
+		return err
+	}
+
 	key := getKey(channelID, url)
 	if err := p.addSubscription(key, sub); err != nil {
 		p.API.LogError(err.Error())
@@ -48,7 +134,7 @@ func (p *RSSFeedPlugin) addSubscription(key string, sub *Subscription) error {
 	// check if url already exists
 	_, ok := currentSubscriptions.Subscriptions[key]
 	if !ok {
-		currentSubscriptions.Subscriptions[key] = &Subscription{ChannelID: sub.ChannelID, URL: sub.URL}
+		currentSubscriptions.Subscriptions[key] = sub
 		err = p.storeSubscriptions(currentSubscriptions)
 		if err != nil {
 			p.API.LogError(err.Error())
@@ -72,14 +158,59 @@ func (p *RSSFeedPlugin) getSubscriptions() (*Subscriptions, error) {
 	if value == nil {
 		subscriptions = &Subscriptions{Subscriptions: map[string]*Subscription{}}
 	} else {
-		json.NewDecoder(bytes.NewReader(value)).Decode(&subscriptions)
+		var decodeErr error
+		if subscriptions, decodeErr = decodeSubscriptions(value, p.getConfiguration().EncryptionKey); decodeErr != nil {
+			p.API.LogError(decodeErr.Error())
+			return nil, decodeErr
+		}
 	}
 
 	return subscriptions, nil
 }
 
+func (p *RSSFeedPlugin) getSubscription(channelID string, url string) (*Subscription, error) {
+	currentSubscriptions, err := p.getSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := currentSubscriptions.findKey(channelID, url)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("this channel is not subscribed to %s", url)
+	}
+
+	return currentSubscriptions.Subscriptions[key], nil
+}
+
+// errAmbiguousURL is returned for a redacted URL that matches several
+// subscriptions, e.g. to the same feed with different tokens.
+var errAmbiguousURL = errors.New("several subscriptions of this channel match the url, please give the full url")
+
+// findKey returns the key of the subscription of a channel to a URL, which
+// may also be given as shown redacted, or an empty key if there is none.
+func (s *Subscriptions) findKey(channelID string, url string) (string, error) {
+	key := getKey(channelID, url)
+	if _, ok := s.Subscriptions[key]; ok {
+		return key, nil
+	}
+
+	found := ""
+	for key, subscription := range s.Subscriptions {
+		if subscription.ChannelID == channelID && matchesURL(subscription.URL, url) {
+			if len(found) > 0 {
+				return "", errAmbiguousURL
+			}
+			found = key
+		}
+	}
+	return found, nil
+}
+
 func (p *RSSFeedPlugin) storeSubscriptions(s *Subscriptions) error {
-	b, err := json.Marshal(s)
+	b, err := encodeSubscriptions(s, p.getConfiguration().EncryptionKey)
 	if err != nil {
 		p.API.LogError(err.Error())
 		return err
@@ -97,14 +228,26 @@ func (p *RSSFeedPlugin) unsubscribe(channelID string, url string) error {
 		return err
 	}
 
-	key := getKey(channelID, url)
-	_, ok := currentSubscriptions.Subscriptions[key]
-	if ok {
+	key, err := currentSubscriptions.findKey(channelID, url)
+	if err != nil {
+		return err
+	}
+	if len(key) > 0 {
+		subscription := currentSubscriptions.Subscriptions[key]
 		delete(currentSubscriptions.Subscriptions, key)
 		if err := p.storeSubscriptions(currentSubscriptions); err != nil {
 			p.API.LogError(err.Error())
 			return err
 		}
+
+		for _, target := range subscription.deliveryTargets() {
+			if err := p.API.KVDelete(getDigestKey(target)); err != nil {
+				p.API.LogError(err.Error())
+			}
+			if err := p.API.KVDelete(getQueueKey(target)); err != nil {
+				p.API.LogError(err.Error())
+			}
+		}
 	}
 
 	return nil
@@ -129,6 +272,286 @@ func (p *RSSFeedPlugin) updateSubscription(subscription *Subscription) error {
 	return nil
 }
 
+// updateSubscriptionState stores what the heartbeat keeps track of for a
+// subscription: the last feed, the posted items, the thread and digest state
+// and the reminders. Everything else is kept as stored, as it may have been
+// changed with /feed since the heartbeat loaded the subscription.
+func (p *RSSFeedPlugin) updateSubscriptionState(subscription *Subscription) error {
+	currentSubscriptions, err := p.getSubscriptions()
+	if err != nil {
+		p.API.LogError(err.Error())
+		return err
+	}
+
+	stored, ok := currentSubscriptions.Subscriptions[getKey(subscription.ChannelID, subscription.URL)]
+	if !ok {
+		return nil
+	}
+
+	stored.XML = subscription.XML
+	stored.PostIDs = subscription.PostIDs
+	stored.ItemKeys = subscription.ItemKeys
+	stored.Reminded = subscription.Reminded
+	// changing the thread or digest option resets their state
+	if stored.Thread == subscription.Thread {
+		stored.RootPostID = subscription.RootPostID
+		stored.RootPostCreated = subscription.RootPostCreated
+		stored.RouteThreads = subscription.RouteThreads
+	}
+	if stored.Digest == subscription.Digest {
+		stored.DigestLastSent = subscription.DigestLastSent
+	}
+
+	if err := p.storeSubscriptions(currentSubscriptions); err != nil {
+		p.API.LogError(err.Error())
+		return err
+	}
+	return nil
+}
+
+// setOption changes one of the options set with /feed set.
+func (s *Subscription) setOption(name string, value string) error {
+	switch name {
+	case "thread":
+		if value == "off" {
+			value = threadOff
+		}
+		if !isValidThreadMode(value) {
+			return fmt.Errorf("invalid thread value %s, expected off, daily or weekly", value)
+		}
+		if s.Thread != value {
+			s.RootPostID = ""
+			s.RootPostCreated = 0
+			s.RouteThreads = nil
+		}
+		s.Thread = value
+	case "digest":
+		if value == "off" {
+			s.Digest = digestOff
+			break
+		}
+		if _, err := parseDigestSchedule(value); err != nil {
+			return err
+		}
+		// the first digest is due at the next scheduled time, not right away
+		if s.Digest == digestOff {
+			s.DigestLastSent = time.Now().UnixNano() / int64(time.Millisecond)
+		}
+		s.Digest = value
+	case "window":
+		if value == "off" {
+			s.Window = ""
+			break
+		}
+		if _, err := parseDeliveryWindow(value); err != nil {
+			return err
+		}
+		s.Window = value
+	case "timezone":
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("invalid time zone %s", value)
+		}
+		s.Timezone = value
+	case "categories":
+		s.Categories = nil
+		if value == "off" {
+			break
+		}
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); len(category) > 0 {
+				s.Categories = append(s.Categories, category)
+			}
+		}
+	case "maxage":
+		if value == "default" {
+			s.MaxAge = 0
+			break
+		}
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			return fmt.Errorf("invalid maxage value %s, expected a number of days or default", value)
+		}
+		s.MaxAge = days
+	case "maxposts":
+		if value == "default" {
+			s.MaxPosts = 0
+			break
+		}
+		maxPosts, err := strconv.Atoi(value)
+		if err != nil || maxPosts <= 0 {
+			return fmt.Errorf("invalid maxposts value %s, expected a number of posts or default", value)
+		}
+		s.MaxPosts = maxPosts
+	case "fullarticle":
+		switch value {
+		case "on":
+			s.FullArticle = true
+		case "off":
+			s.FullArticle = false
+		default:
+			return fmt.Errorf("invalid fullarticle value %s, expected on or off", value)
+		}
+	case "insecure":
+		switch value {
+		case "on":
+			s.Insecure = true
+		case "off":
+			s.Insecure = false
+		default:
+			return fmt.Errorf("invalid insecure value %s, expected on or off", value)
+		}
+	case "type":
+		switch value {
+		case "feed":
+			s.Type = subscriptionTypeFeed
+		case subscriptionTypeHTML, subscriptionTypeJSON, subscriptionTypeICS:
+			s.Type = value
+		default:
+			return fmt.Errorf("invalid type %s, expected feed, html, json or ics", value)
+		}
+	case "remind":
+		if value == "off" {
+			s.Remind = 0
+			break
+		}
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			return fmt.Errorf("invalid remind value %s, expected a number of minutes or off", value)
+		}
+		s.Remind = minutes
+	case "item", "id", "title", "link", "date", "body":
+		if s.Mapping == nil {
+			s.Mapping = &ItemMapping{}
+		}
+		s.Mapping.setField(name, value)
+	default:
+		return fmt.Errorf("unknown option %s", name)
+	}
+
+	return nil
+}
+
+// validate checks the options that depend on each other once all of them
+// have been set.
+func (s *Subscription) validate() error {
+	switch s.Type {
+	case subscriptionTypeHTML:
+		return validateHTMLMapping(s.Mapping)
+	case subscriptionTypeJSON:
+		return validateJSONMapping(s.Mapping)
+	}
+	return nil
+}
+
+// describeFilters lists the filters of the subscription for /feed list.
+func (s *Subscription) describeFilters() string {
+	txt := ""
+	for _, filter := range s.Filters {
+		txt += fmt.Sprintf("  * %s `%s`\n", filter.Type, filter.Pattern)
+	}
+	return txt
+}
+
+// describeOptions lists the options that differ from the defaults for /feed list.
+func (s *Subscription) describeOptions() string {
+	options := []string{}
+	if s.Thread != threadOff {
+		options = append(options, "thread: "+s.Thread)
+	}
+	if s.Digest != digestOff {
+		options = append(options, "digest: "+s.Digest)
+	}
+	if len(s.Window) > 0 {
+		options = append(options, "window: "+s.Window)
+	}
+	if len(s.Timezone) > 0 {
+		options = append(options, "timezone: "+s.Timezone)
+	}
+	if len(s.Categories) > 0 {
+		options = append(options, "categories: "+strings.Join(s.Categories, ","))
+	}
+	if s.MaxAge > 0 {
+		options = append(options, fmt.Sprintf("maxage: %d days", s.MaxAge))
+	}
+	if s.MaxPosts > 0 {
+		options = append(options, fmt.Sprintf("maxposts: %d", s.MaxPosts))
+	}
+	if s.FullArticle {
+		options = append(options, "fullarticle: on")
+	}
+	if s.Insecure {
+		options = append(options, "insecure: on")
+	}
+	if len(s.Auth) > 0 {
+		options = append(options, "auth: on")
+	}
+	if s.Type != subscriptionTypeFeed {
+		options = append(options, "type: "+s.Type)
+	}
+	if s.Remind > 0 {
+		options = append(options, fmt.Sprintf("remind: %d minutes", s.Remind))
+	}
+	if s.Mapping != nil {
+		for _, field := range s.Mapping.fields() {
+			if len(field[1]) > 0 {
+				options = append(options, field[0]+": "+field[1])
+			}
+		}
+	}
+
+	if len(options) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(options, ", ") + ")"
+}
+
+// setRoute routes a category to a channel, or removes the route if channelID
+// is empty.
+func (s *Subscription) setRoute(category string, channelID string) {
+	category = strings.ToLower(category)
+	if len(channelID) == 0 {
+		delete(s.Routes, category)
+		return
+	}
+
+	if s.Routes == nil {
+		s.Routes = map[string]string{}
+	}
+	s.Routes[category] = channelID
+}
+
+// location returns the time zone of the subscription, falling back to the
+// server's local time zone.
+func (s *Subscription) location() *time.Location {
+	if len(s.Timezone) > 0 {
+		if location, err := time.LoadLocation(s.Timezone); err == nil {
+			return location
+		}
+	}
+	return time.Local
+}
+
+func (s *Subscription) setPostID(itemKey string, postID string) {
+	if s.PostIDs == nil {
+		s.PostIDs = map[string]string{}
+	}
+	s.PostIDs[itemKey] = postID
+}
+
+// prunePostIDs forgets the posts of items that are no longer part of the feed.
+func (s *Subscription) prunePostIDs(itemKeys []string) {
+	current := map[string]bool{}
+	for _, key := range itemKeys {
+		current[key] = true
+	}
+
+	for key := range s.PostIDs {
+		if !current[key] {
+			delete(s.PostIDs, key)
+		}
+	}
+}
+
 func getKey(channelID string, url string) string {
 	return fmt.Sprintf("%s/%s", channelID, url)
 }
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestFindKey(t *testing.T) {
+	subscriptions := &Subscriptions{Subscriptions: map[string]*Subscription{}}
+	for _, subscription := range []*Subscription{
+		{ChannelID: "channel", URL: "https://example.com/feed?token=one"},
+		{ChannelID: "channel", URL: "https://example.com/other?token=secret"},
+		{ChannelID: "channel", URL: "https://example.com/feed?token=two"},
+		{ChannelID: "other", URL: "https://example.com/single?token=secret"},
+	} {
+		subscriptions.Subscriptions[getKey(subscription.ChannelID, subscription.URL)] = subscription
+	}
+
+	for _, test := range []struct {
+		name      string
+		channelID string
+		url       string
+		expected  string
+		ambiguous bool
+	}{
+		{"exact", "channel", "https://example.com/feed?token=one", "channel/https://example.com/feed?token=one", false},
+		{"redacted", "channel", "https://example.com/other?token=REDACTED", "channel/https://example.com/other?token=secret", false},
+		{"redacted ambiguous", "channel", "https://example.com/feed?token=REDACTED", "", true},
+		{"other channel", "channel", "https://example.com/single?token=REDACTED", "", false},
+		{"unknown", "channel", "https://example.com/unknown", "", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := subscriptions.findKey(test.channelID, test.url)
+			if test.ambiguous {
+				if err != errAmbiguousURL {
+					t.Errorf("expected an ambiguous match, got %q, %v", key, err)
+				}
+				return
+			}
+			if err != nil || key != test.expected {
+				t.Errorf("got %q, %v, want %q", key, err, test.expected)
+			}
+		})
+	}
+}
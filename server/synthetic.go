@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+)
+
+// Types of subscriptions that are not RSS or Atom feeds. Their items are
+// derived by the plugin and compared by key between checks.
+const (
+	subscriptionTypeFeed = ""
+	subscriptionTypeHTML = "html"
+	subscriptionTypeJSON = "json"
+)
+
+// ItemMapping derives the items of a synthetic feed from the fetched
+// document: CSS selectors for html subscriptions and JSONPath expressions for
+// json subscriptions. Item selects the items, the other fields are evaluated
+// within each item.
+type ItemMapping struct {
+	Item  string
+	ID    string
+	Title string
+	Link  string
+	Date  string
+	Body  string
+}
+
+// fields returns the option name and value of every field of the mapping.
+func (m *ItemMapping) fields() [][2]string {
+	return [][2]string{
+		{"item", m.Item},
+		{"id", m.ID},
+		{"title", m.Title},
+		{"link", m.Link},
+		{"date", m.Date},
+		{"body", m.Body},
+	}
+}
+
+func (m *ItemMapping) setField(name string, value string) {
+	switch name {
+	case "item":
+		m.Item = value
+	case "id":
+		m.ID = value
+	case "title":
+		m.Title = value
+	case "link":
+		m.Link = value
+	case "date":
+		m.Date = value
+	case "body":
+		m.Body = value
+	}
+}
+
+// processSyntheticItems posts the items of a synthetic feed that were not
+// part of the previous check. Like for RSS and Atom feeds, only the first item
+// is posted the first time a subscription is checked.
+func (p *RSSFeedPlugin) processSyntheticItems(subscription *Subscription, items []*feedItem) {
+	previous := map[string]bool{}
+	for _, key := range subscription.ItemKeys {
+		previous[key] = true
+	}
+
+	newItems := []*feedItem{}
+	keys := []string{}
+	for _, item := range items {
+		keys = append(keys, item.Key)
+		if !previous[item.Key] {
+			newItems = append(newItems, item)
+		}
+	}
+
+	if len(subscription.ItemKeys) == 0 && len(newItems) > 0 {
+		newItems = newItems[:1]
+	}
+
+	p.deliverItems(subscription, newItems)
+
+	if len(newItems) > 0 || len(keys) != len(subscription.ItemKeys) {
+		subscription.ItemKeys = keys
+		subscription.prunePostIDs(keys)
+		p.updateSubscriptionState(subscription)
+	}
+}
+
+// formatFeedItem renders an item of a synthetic feed the same way as an RSS item.
+func (p *RSSFeedPlugin) formatFeedItem(subscription *Subscription, item *feedItem) string {
+	config := p.getConfiguration()
+	post := ""
+
+	if config.FormatTitle {
+		post = post + "##### "
+	}
+	post = post + item.FeedTitle + "\n"
+
+	if len(item.Title) > 0 {
+		if config.FormatTitle {
+			post = post + "###### "
+		}
+		post = post + item.Title + "\n"
+	}
+
+	if len(item.Link) > 0 {
+		post = post + item.Link + "\n"
+	}
+
+	if article := p.getFullArticle(subscription, item.Link); len(article) > 0 {
+		post = post + article + "\n"
+	} else if content := strings.TrimSpace(item.Content); len(content) > 0 {
+		post = post + renderHTML(content, item.Link) + "\n"
+	}
+
+	return post
+}
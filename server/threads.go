@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Values of the thread subscription option.
+const (
+	threadOff    = ""
+	threadDaily  = "daily"
+	threadWeekly = "weekly"
+)
+
+func isValidThreadMode(mode string) bool {
+	return mode == threadOff || mode == threadDaily || mode == threadWeekly
+}
+
+// ensureRootPost returns the root post of the subscription's thread, creating
+// a new one if there is none yet or the current one has to be rotated.
+func (p *RSSFeedPlugin) ensureRootPost(subscription *Subscription, feedTitle string, now time.Time) (string, error) {
+	if len(subscription.RootPostID) > 0 && !shouldRotateRootPost(subscription, now) {
+		return subscription.RootPostID, nil
+	}
+
+	message := ""
+	if p.getConfiguration().FormatTitle {
+		message = message + "##### "
+	}
+	message = message + feedTitle + "\n"
+	if subscription.Thread == threadWeekly {
+		message = message + fmt.Sprintf("_Items for the week of %s_\n", periodStart(threadWeekly, now).Format("January 2, 2006"))
+	} else {
+		message = message + fmt.Sprintf("_Items for %s_\n", now.Format("January 2, 2006"))
+	}
+
+	root, err := p.createBotPost(subscription.ChannelID, message, "custom_git_pr")
+	if err != nil {
+		return "", err
+	}
+
+	subscription.RootPostID = root.Id
+	subscription.RootPostCreated = root.CreateAt
+	return root.Id, nil
+}
+
+// shouldRotateRootPost reports whether the root post was created before the
+// start of the current day or week.
+func shouldRotateRootPost(subscription *Subscription, now time.Time) bool {
+	created := time.Unix(0, subscription.RootPostCreated*int64(time.Millisecond)).In(now.Location())
+	return created.Before(periodStart(subscription.Thread, now))
+}
+
+// periodStart returns the beginning of the day, or of the week starting on
+// Monday, that contains now.
+func periodStart(mode string, now time.Time) time.Time {
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if mode == threadWeekly {
+		offset := (int(start.Weekday()) + 6) % 7
+		start = start.AddDate(0, 0, -offset)
+	}
+	return start
+}
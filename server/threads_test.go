@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func TestCreateItemPostThreads(t *testing.T) {
+	p, api := newTestPlugin()
+	subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/feed", Thread: threadDaily, Timezone: "UTC"}
+
+	first, err := p.createItemPost(subscription, "Feed", "first\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.createItemPost(subscription, "Feed", "second\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.channelPosts("channel")
+	if len(posts) != 3 || posts[0].Id != subscription.RootPostID || first.RootId != posts[0].Id || second.RootId != posts[0].Id {
+		t.Errorf("expected both items to be posted to one thread, got %v", posts)
+	}
+}
+
+func TestCreateItemPostReplacesDeletedRootPost(t *testing.T) {
+	p, api := newTestPlugin()
+	// replying to a deleted post fails
+	api.failPosts = func(post *model.Post) bool {
+		_, ok := api.posts[post.RootId]
+		return len(post.RootId) > 0 && !ok
+	}
+	subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/feed", Thread: threadDaily, Timezone: "UTC"}
+
+	if _, err := p.createItemPost(subscription, "Feed", "first\n", ""); err != nil {
+		t.Fatal(err)
+	}
+	deleted := subscription.RootPostID
+	delete(api.posts, deleted)
+
+	post, err := p.createItemPost(subscription, "Feed", "second\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.RootPostID == deleted || post.RootId != subscription.RootPostID {
+		t.Errorf("expected a new root post, got %s replying to %s", subscription.RootPostID, post.RootId)
+	}
+	if created := time.Unix(0, subscription.RootPostCreated*int64(time.Millisecond)); time.Since(created) > time.Minute {
+		t.Errorf("unexpected creation time of the new root post %v", created)
+	}
+
+	posts := api.channelPosts("channel")
+	if len(posts) != 4 || posts[2].Id != subscription.RootPostID || posts[3].Message != "second\n" {
+		t.Errorf("unexpected posts %v", posts)
+	}
+}
+
+func TestCreateItemPostDoesNotReplaceNewRootPost(t *testing.T) {
+	p, api := newTestPlugin()
+	api.failPosts = func(post *model.Post) bool {
+		return len(post.RootId) > 0
+	}
+	subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/feed", Thread: threadDaily, Timezone: "UTC"}
+
+	if _, err := p.createItemPost(subscription, "Feed", "first\n", ""); err == nil {
+		t.Fatal("expected the reply to fail")
+	}
+	if posts := api.channelPosts("channel"); len(posts) != 1 || posts[0].Id != subscription.RootPostID {
+		t.Errorf("expected a single root post, got %v", posts)
+	}
+}
+
+func TestShouldRotateRootPost(t *testing.T) {
+	// March 3, 2021 is a Wednesday
+	now := time.Date(2021, time.March, 3, 10, 0, 0, 0, time.UTC)
+	millis := func(t time.Time) int64 {
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+
+	for _, test := range []struct {
+		thread   string
+		created  time.Time
+		expected bool
+	}{
+		{threadDaily, now.Add(-time.Hour), false},
+		{threadDaily, now.Add(-11 * time.Hour), true},
+		{threadWeekly, now.AddDate(0, 0, -2), false},
+		{threadWeekly, now.AddDate(0, 0, -3), true},
+	} {
+		subscription := &Subscription{Thread: test.thread, RootPostCreated: millis(test.created)}
+		if actual := shouldRotateRootPost(subscription, now); actual != test.expected {
+			t.Errorf("%s root post created %v: got %v, want %v", test.thread, test.created, actual, test.expected)
+		}
+	}
+}
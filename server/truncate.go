@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// Values of the LongPostMode setting.
+const (
+	longPostModeTruncate = "truncate"
+	longPostModeSplit    = "split"
+)
+
+// minPostLength keeps the maximum post length above the length of a link
+// to the item.
+const minPostLength = 500
+
+// codeFence is the markdown code block delimiter that has to be closed when a
+// message is cut inside of a code block.
+const codeFence = "```"
+
+// getMaxPostLength returns the maximum number of characters of a post, which
+// is bounded by what the Mattermost server accepts.
+func (p *RSSFeedPlugin) getMaxPostLength() int {
+	maxLength, err := strconv.Atoi(p.getConfiguration().MaxPostLength)
+	if err != nil || maxLength <= 0 || maxLength > model.POST_MESSAGE_MAX_RUNES_V2 {
+		return model.POST_MESSAGE_MAX_RUNES_V2
+	}
+	if maxLength < minPostLength {
+		return minPostLength
+	}
+	return maxLength
+}
+
+// splitMessage fits a message into posts of at most the maximum post length.
+// Depending on the LongPostMode setting, a long message is either truncated
+// with a link to the item, or split into several parts.
+func (p *RSSFeedPlugin) splitMessage(message string, link string) []string {
+	if p.getConfiguration().LongPostMode != longPostModeSplit {
+		return []string{p.truncateMessage(message, link)}
+	}
+
+	limit := p.getMaxPostLength() - len(codeFence) - 1
+	parts := []string{}
+	for len(parts) == 0 || len(message) > 0 {
+		part, rest := cutMessage(message, limit)
+		parts = append(parts, part)
+		message = rest
+	}
+	return parts
+}
+
+// truncateMessage shortens a message to the maximum post length, appending a
+// link to the item if anything was cut.
+// The link is left out if it would take up more than half of the post.
+func (p *RSSFeedPlugin) truncateMessage(message string, link string) string {
+	maxLength := p.getMaxPostLength()
+	if utf8.RuneCountInString(message) <= maxLength {
+		return message
+	}
+
+	suffix := "\n\n[Read more](" + link + ")"
+	if len(link) == 0 || utf8.RuneCountInString(suffix) > maxLength/2 {
+		suffix = "\n\n..."
+	}
+
+	part, _ := cutMessage(message, maxLength-utf8.RuneCountInString(suffix)-len(codeFence)-1)
+	return part + suffix
+}
+
+// cutMessage splits a message after at most limit characters, preferably at
+// the end of a paragraph, line or word. A code block left open by the cut is
+// closed in the first part and reopened in the rest.
+func cutMessage(message string, limit int) (string, string) {
+	if limit < 1 {
+		limit = 1
+	}
+	if utf8.RuneCountInString(message) <= limit {
+		return message, ""
+	}
+
+	head := string([]rune(message)[:limit])
+	cut := len(head)
+	for _, separator := range []string{"\n\n", "\n", " "} {
+		if i := strings.LastIndex(head, separator); i > len(head)/2 {
+			cut = i
+			break
+		}
+	}
+
+	part := strings.TrimRight(message[:cut], " \n")
+	rest := strings.TrimLeft(message[cut:], " \n")
+	if strings.Count(part, codeFence)%2 == 1 {
+		part = part + "\n" + codeFence
+		rest = codeFence + "\n" + rest
+	}
+
+	return part, rest
+}
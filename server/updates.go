@@ -0,0 +1,191 @@
+package main
+
+import (
+	"strings"
+
+	rssv2parser "github.com/wbernest/rss-v2-parser"
+	"golang.org/x/tools/blog/atom"
+)
+
+// Values of the ItemUpdateMode setting.
+const (
+	itemUpdateModeIgnore = "ignore"
+	itemUpdateModeEdit   = "edit"
+	itemUpdateModeMark   = "mark"
+	itemUpdateModeReply  = "reply"
+)
+
+type updatedRSSItem struct {
+	oldItem *rssv2parser.Item
+	newItem *rssv2parser.Item
+}
+
+type updatedAtomEntry struct {
+	oldEntry *atom.Entry
+	newEntry *atom.Entry
+}
+
+// rssItemKey identifies an RSS item the same way rssv2parser does when
+// comparing feeds: by guid, or by publication date and title otherwise.
+func rssItemKey(item *rssv2parser.Item) string {
+	if len(item.GUID) > 0 {
+		return item.GUID
+	}
+	return item.PubDate + "|" + item.Title
+}
+
+func rssItemKeys(feed *rssv2parser.RSSV2) []string {
+	keys := []string{}
+	for i := range feed.Channel.ItemList {
+		keys = append(keys, rssItemKey(&feed.Channel.ItemList[i]))
+	}
+	return keys
+}
+
+func atomEntryKeys(feed *atom.Feed) []string {
+	keys := []string{}
+	for _, entry := range feed.Entry {
+		keys = append(keys, entry.ID)
+	}
+	return keys
+}
+
+// findUpdatedRSSItems returns the items present in both feeds whose title,
+// link or description changed.
+func (p *RSSFeedPlugin) findUpdatedRSSItems(oldFeed *rssv2parser.RSSV2, newFeed *rssv2parser.RSSV2) []updatedRSSItem {
+	updated := []updatedRSSItem{}
+	if p.getConfiguration().ItemUpdateMode == itemUpdateModeIgnore {
+		return updated
+	}
+
+	oldItems := map[string]*rssv2parser.Item{}
+	for i := range oldFeed.Channel.ItemList {
+		oldItems[rssItemKey(&oldFeed.Channel.ItemList[i])] = &oldFeed.Channel.ItemList[i]
+	}
+
+	for i := range newFeed.Channel.ItemList {
+		newItem := &newFeed.Channel.ItemList[i]
+		oldItem, ok := oldItems[rssItemKey(newItem)]
+		if !ok {
+			continue
+		}
+
+		if oldItem.Title != newItem.Title ||
+			strings.TrimSpace(oldItem.Link) != strings.TrimSpace(newItem.Link) ||
+			oldItem.Description != newItem.Description {
+			updated = append(updated, updatedRSSItem{oldItem: oldItem, newItem: newItem})
+		}
+	}
+
+	return updated
+}
+
+// findUpdatedAtomEntries returns the entries present in both feeds whose
+// updated timestamp changed.
+func (p *RSSFeedPlugin) findUpdatedAtomEntries(oldFeed *atom.Feed, newFeed *atom.Feed) []updatedAtomEntry {
+	updated := []updatedAtomEntry{}
+	if p.getConfiguration().ItemUpdateMode == itemUpdateModeIgnore {
+		return updated
+	}
+
+	oldEntries := map[string]*atom.Entry{}
+	for _, entry := range oldFeed.Entry {
+		oldEntries[entry.ID] = entry
+	}
+
+	for _, newEntry := range newFeed.Entry {
+		oldEntry, ok := oldEntries[newEntry.ID]
+		if !ok {
+			continue
+		}
+
+		if len(newEntry.Updated) > 0 && oldEntry.Updated != newEntry.Updated {
+			updated = append(updated, updatedAtomEntry{oldEntry: oldEntry, newEntry: newEntry})
+		}
+	}
+
+	return updated
+}
+
+// updateItemPost edits the post previously created for an item according to
+// the ItemUpdateMode setting. Items that were never posted are skipped.
+func (p *RSSFeedPlugin) updateItemPost(subscription *Subscription, itemKey string, link string, oldMessage string, newMessage string) {
+	postID, ok := subscription.PostIDs[itemKey]
+	if !ok || oldMessage == newMessage {
+		return
+	}
+
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		p.API.LogInfo("Unable to find post of updated feed item",
+			"subscription_url", redactURL(subscription.URL),
+			"post_id", postID,
+			"err", appErr.Error())
+		delete(subscription.PostIDs, itemKey)
+		return
+	}
+
+	mode := p.getConfiguration().ItemUpdateMode
+	post.Message = newMessage
+	if mode == itemUpdateModeMark {
+		post.Message = post.Message + "\n_Updated_\n"
+	}
+	post.Message = p.truncateMessage(post.Message, link)
+
+	if _, appErr = p.API.UpdatePost(post); appErr != nil {
+		p.API.LogError(appErr.Error())
+		return
+	}
+
+	if mode == itemUpdateModeReply {
+		rootID := post.Id
+		if len(post.RootId) > 0 {
+			rootID = post.RootId
+		}
+		reply := p.truncateMessage("This item has been updated:\n```diff\n"+diffLines(oldMessage, newMessage)+"```\n", link)
+		p.createBotReply(post.ChannelId, rootID, reply, "custom_git_pr")
+	}
+}
+
+// diffLines produces a line based diff of two messages, prefixing removed
+// lines with "-", added lines with "+" and unchanged lines with a space.
+func diffLines(oldText string, newText string) string {
+	a := strings.Split(strings.TrimRight(oldText, "\n"), "\n")
+	b := strings.Split(strings.TrimRight(newText, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			diff.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			diff.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+
+	return diff.String()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{{
+		name:     "unchanged",
+		old:      "a\nb\n",
+		new:      "a\nb",
+		expected: "  a\n  b\n",
+	}, {
+		name:     "changed line",
+		old:      "title\nold body\nlink",
+		new:      "title\nnew body\nlink",
+		expected: "  title\n- old body\n+ new body\n  link\n",
+	}, {
+		name:     "added and removed lines",
+		old:      "a\nb\nc\nd",
+		new:      "b\nc\nx\nd\ne",
+		expected: "- a\n  b\n  c\n+ x\n  d\n+ e\n",
+	}, {
+		name:     "nothing in common",
+		old:      "a\nb",
+		new:      "c",
+		expected: "- a\n- b\n+ c\n",
+	}, {
+		name:     "from empty",
+		old:      "",
+		new:      "a",
+		expected: "- \n+ a\n",
+	}} {
+		if actual := diffLines(test.old, test.new); actual != test.expected {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestDiffLinesKeepsLongestCommonSubsequence(t *testing.T) {
+	for _, test := range []struct {
+		old    string
+		new    string
+		common int
+	}{
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", 4},
+		{"x\na\ny\nb\nz", "a\nb\nx\ny\nz", 3},
+		{"a\na\na", "a\nb\na", 2},
+	} {
+		var oldLines, newLines []string
+		common := 0
+		for _, line := range strings.Split(strings.TrimSuffix(diffLines(test.old, test.new), "\n"), "\n") {
+			switch line[:2] {
+			case "  ":
+				oldLines = append(oldLines, line[2:])
+				newLines = append(newLines, line[2:])
+				common++
+			case "- ":
+				oldLines = append(oldLines, line[2:])
+			case "+ ":
+				newLines = append(newLines, line[2:])
+			}
+		}
+
+		if strings.Join(oldLines, "\n") != test.old || strings.Join(newLines, "\n") != test.new {
+			t.Errorf("diffing %q and %q: the diff does not reproduce both texts", test.old, test.new)
+		}
+		if common != test.common {
+			t.Errorf("diffing %q and %q: got %d unchanged lines, want %d", test.old, test.new, common, test.common)
+		}
+	}
+}
+
+func TestUpdateItemPost(t *testing.T) {
+	for _, test := range []struct {
+		mode     string
+		expected string
+		reply    string
+	}{
+		{itemUpdateModeEdit, "new title\nbody\n", ""},
+		{itemUpdateModeMark, "new title\nbody\n\n_Updated_\n", ""},
+		{itemUpdateModeReply, "new title\nbody\n", "This item has been updated:\n```diff\n- old title\n+ new title\n  body\n```\n"},
+	} {
+		p, api := newTestPlugin()
+		p.setConfiguration(&configuration{ItemUpdateMode: test.mode})
+		subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/feed"}
+
+		post, err := p.createBotPost("channel", "old title\nbody\n", "custom_git_pr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subscription.setPostID("item", post.Id)
+
+		p.updateItemPost(subscription, "item", "https://example.com/item", "old title\nbody\n", "new title\nbody\n")
+
+		if updated := api.posts[post.Id]; updated.Message != test.expected {
+			t.Errorf("%s: got message %q, want %q", test.mode, updated.Message, test.expected)
+		}
+
+		posts := api.channelPosts("channel")
+		if len(test.reply) == 0 {
+			if len(posts) != 1 {
+				t.Errorf("%s: expected no reply, got %v", test.mode, posts[1:])
+			}
+			continue
+		}
+		if len(posts) != 2 || posts[1].RootId != post.Id || posts[1].Message != test.reply {
+			t.Errorf("%s: unexpected reply %v", test.mode, posts[1:])
+		}
+	}
+}
+
+func TestUpdateItemPostReplyInThread(t *testing.T) {
+	p, api := newTestPlugin()
+	p.setConfiguration(&configuration{ItemUpdateMode: itemUpdateModeReply})
+	subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/feed"}
+
+	root, _ := p.createBotPost("channel", "root", "custom_git_pr")
+	post, _ := p.createBotReply("channel", root.Id, "old", "custom_git_pr")
+	subscription.setPostID("item", post.Id)
+
+	p.updateItemPost(subscription, "item", "", "old", "new")
+
+	posts := api.channelPosts("channel")
+	if len(posts) != 3 || posts[2].RootId != root.Id || !strings.Contains(posts[2].Message, "- old\n+ new\n") {
+		t.Errorf("expected the reply to be posted to the thread, got %v", posts)
+	}
+}
+
+func TestUpdateItemPostSkipped(t *testing.T) {
+	p, api := newTestPlugin()
+	p.setConfiguration(&configuration{ItemUpdateMode: itemUpdateModeReply})
+	subscription := &Subscription{ChannelID: "channel", URL: "https://example.com/feed"}
+
+	post, _ := p.createBotPost("channel", "old", "custom_git_pr")
+	subscription.setPostID("item", post.Id)
+	subscription.setPostID("deleted", "missing")
+
+	// unchanged and never posted items are left alone
+	p.updateItemPost(subscription, "item", "", "old", "old")
+	p.updateItemPost(subscription, "unknown", "", "old", "new")
+	if api.posts[post.Id].Message != "old" || len(api.created) != 1 {
+		t.Errorf("expected the post to be unchanged, got %v", api.created)
+	}
+
+	// items whose post is gone are forgotten
+	p.updateItemPost(subscription, "deleted", "", "old", "new")
+	if _, ok := subscription.PostIDs["deleted"]; ok || len(api.created) != 1 {
+		t.Errorf("expected the deleted post to be forgotten, got %v", subscription.PostIDs)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// deliveryWindow is the parsed form of a window option such as
+// mon-fri@08:00-18:00. Items arriving outside of the window are queued.
+type deliveryWindow struct {
+	Days [7]bool
+	// Start and End are minutes after midnight. A window ending before it
+	// starts spans midnight.
+	Start int
+	End   int
+}
+
+func parseDeliveryWindow(value string) (*deliveryWindow, error) {
+	window := &deliveryWindow{}
+	days := ""
+	hours := value
+	if i := strings.Index(value, "@"); i >= 0 {
+		days, hours = value[:i], value[i+1:]
+	}
+
+	if len(days) == 0 {
+		for i := range window.Days {
+			window.Days[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(strings.ToLower(days), ",") {
+			bounds := strings.Split(part, "-")
+			first, ok := weekdays[bounds[0]]
+			if !ok || len(bounds) > 2 {
+				return nil, fmt.Errorf("invalid days %s, expected e.g. mon-fri or sat,sun", days)
+			}
+			last := first
+			if len(bounds) == 2 {
+				if last, ok = weekdays[bounds[1]]; !ok {
+					return nil, fmt.Errorf("invalid days %s, expected e.g. mon-fri or sat,sun", days)
+				}
+			}
+			for day := first; ; day = (day + 1) % 7 {
+				window.Days[day] = true
+				if day == last {
+					break
+				}
+			}
+		}
+	}
+
+	bounds := strings.Split(hours, "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid window %s, expected e.g. mon-fri@08:00-18:00", value)
+	}
+	var err error
+	if window.Start, err = parseTimeOfDay(bounds[0]); err != nil {
+		return nil, err
+	}
+	if window.End, err = parseTimeOfDay(bounds[1]); err != nil {
+		return nil, err
+	}
+
+	return window, nil
+}
+
+// parseTimeOfDay parses HH:MM into minutes after midnight.
+func parseTimeOfDay(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", value)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", value)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute > 0) {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// contains reports whether now is inside the window. For windows spanning
+// midnight the day of the window's start is used.
+func (w *deliveryWindow) contains(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	if w.Start <= w.End {
+		return w.Days[now.Weekday()] && minute >= w.Start && minute < w.End
+	}
+
+	if minute >= w.Start {
+		return w.Days[now.Weekday()]
+	}
+	return minute < w.End && w.Days[(now.Weekday()+6)%7]
+}
+
+// isDeliveryOpen reports whether items of the subscription may be posted now,
+// using the subscription's window or else the window of its channel.
+func (p *RSSFeedPlugin) isDeliveryOpen(subscription *Subscription, now time.Time) bool {
+	settings, err := p.getChannelSettings(subscription.ChannelID)
+	if err != nil {
+		p.API.LogError(err.Error())
+		return true
+	}
+
+	value := subscription.Window
+	if len(value) == 0 {
+		value = settings.Window
+	}
+	if len(value) == 0 {
+		return true
+	}
+
+	window, err := parseDeliveryWindow(value)
+	if err != nil {
+		p.API.LogError(err.Error())
+		return true
+	}
+
+	location := subscription.location()
+	if len(subscription.Timezone) == 0 && len(settings.Timezone) > 0 {
+		if channelLocation, err := time.LoadLocation(settings.Timezone); err == nil {
+			location = channelLocation
+		}
+	}
+
+	return window.contains(now.In(location))
+}
+
+func getQueueKey(subscription *Subscription) string {
+	return fmt.Sprintf("queue_%x", md5.Sum([]byte(getKey(subscription.ChannelID, subscription.URL))))
+}
+
+func (p *RSSFeedPlugin) getQueuedItems(subscription *Subscription) ([]*feedItem, error) {
+	items := []*feedItem{}
+
+	value, err := p.API.KVGet(getQueueKey(subscription))
+	if err != nil {
+		return nil, err
+	}
+
+	if value != nil {
+		json.NewDecoder(bytes.NewReader(value)).Decode(&items)
+	}
+
+	return items, nil
+}
+
+func (p *RSSFeedPlugin) queueItem(subscription *Subscription, item *feedItem) error {
+	items, err := p.getQueuedItems(subscription)
+	if err != nil {
+		return err
+	}
+
+	items = append(items, item)
+	b, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+
+	if err := p.API.KVSet(getQueueKey(subscription), b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// processQueue posts the items held back outside of the delivery window of
+// the subscribed channel or of the channel of a route once the window has
+// opened, limited like the items of a cycle.
+func (p *RSSFeedPlugin) processQueue(subscription *Subscription, now time.Time) error {
+	released := false
+	for _, target := range subscription.deliveryTargets() {
+		items, err := p.getQueuedItems(target)
+		if err != nil {
+			return err
+		}
+
+		if len(items) == 0 || !p.isDeliveryOpen(target, now) {
+			continue
+		}
+
+		for _, item := range p.limitItems(target, items) {
+			p.postItem(target, item)
+		}
+
+		if err := p.API.KVDelete(getQueueKey(target)); err != nil {
+			return err
+		}
+		subscription.updateRoute(target)
+		released = true
+	}
+
+	if !released {
+		return nil
+	}
+	return p.updateSubscriptionState(subscription)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeliveryWindow(t *testing.T) {
+	everyDay := [7]bool{true, true, true, true, true, true, true}
+	weekdays := [7]bool{false, true, true, true, true, true, false}
+
+	for _, test := range []struct {
+		value    string
+		expected deliveryWindow
+	}{
+		{"08:00-18:00", deliveryWindow{Days: everyDay, Start: 8 * 60, End: 18 * 60}},
+		{"mon-fri@08:30-17:45", deliveryWindow{Days: weekdays, Start: 8*60 + 30, End: 17*60 + 45}},
+		{"Sat,SUN@10:00-24:00", deliveryWindow{Days: [7]bool{true, false, false, false, false, false, true}, Start: 10 * 60, End: 24 * 60}},
+		{"fri-mon@22:00-06:00", deliveryWindow{Days: [7]bool{true, true, false, false, false, true, true}, Start: 22 * 60, End: 6 * 60}},
+		{"wed@0:00-1:05", deliveryWindow{Days: [7]bool{false, false, false, true, false, false, false}, Start: 0, End: 65}},
+	} {
+		window, err := parseDeliveryWindow(test.value)
+		if err != nil {
+			t.Errorf("parsing %q: %v", test.value, err)
+			continue
+		}
+		if *window != test.expected {
+			t.Errorf("parsing %q: got %+v, want %+v", test.value, *window, test.expected)
+		}
+	}
+
+	for _, value := range []string{
+		"",
+		"08:00",
+		"08:00-18:00-20:00",
+		"monday@08:00-18:00",
+		"mon-fri-sun@08:00-18:00",
+		"mon-xyz@08:00-18:00",
+		"mon,@08:00-18:00",
+		"@8-18",
+		"25:00-26:00",
+		"24:30-06:00",
+		"08:60-18:00",
+		"08:00-18:-1",
+	} {
+		if window, err := parseDeliveryWindow(value); err == nil {
+			t.Errorf("expected parsing %q to fail, got %+v", value, window)
+		}
+	}
+}
+
+func TestDeliveryWindowContains(t *testing.T) {
+	// March 5, 2021 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2021, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, test := range []struct {
+		window   string
+		now      time.Time
+		expected bool
+	}{
+		{"08:00-18:00", at(5, 8, 0), true},
+		{"08:00-18:00", at(5, 17, 59), true},
+		{"08:00-18:00", at(5, 18, 0), false},
+		{"08:00-18:00", at(5, 7, 59), false},
+		{"mon-fri@08:00-18:00", at(5, 12, 0), true},
+		{"mon-fri@08:00-18:00", at(6, 12, 0), false},
+		{"sat,sun@00:00-24:00", at(6, 0, 0), true},
+		{"sat,sun@00:00-24:00", at(7, 23, 59), true},
+		{"sat,sun@00:00-24:00", at(8, 0, 0), false},
+		{"00:00-00:00", at(5, 0, 0), false},
+		// overnight windows belong to the day they start on
+		{"22:00-06:00", at(5, 23, 0), true},
+		{"22:00-06:00", at(6, 5, 59), true},
+		{"22:00-06:00", at(6, 6, 0), false},
+		{"22:00-06:00", at(5, 21, 59), false},
+		{"fri@22:00-06:00", at(5, 22, 0), true},
+		{"fri@22:00-06:00", at(6, 3, 0), true},
+		{"fri@22:00-06:00", at(6, 22, 0), false},
+		{"fri@22:00-06:00", at(5, 3, 0), false},
+		{"sun@22:00-06:00", at(8, 1, 0), true},
+		{"sun@22:00-06:00", at(7, 1, 0), false},
+		{"mon-fri@20:00-02:00", at(6, 1, 59), true},
+		{"mon-fri@20:00-02:00", at(8, 1, 0), false},
+		{"mon-fri@20:00-02:00", at(9, 1, 0), true},
+	} {
+		window, err := parseDeliveryWindow(test.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := window.contains(test.now); actual != test.expected {
+			t.Errorf("%s contains %s: got %v, want %v", test.window, test.now.Format("Mon 15:04"), actual, test.expected)
+		}
+	}
+}